@@ -0,0 +1,121 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errPeerDown is returned instead of calling a peer marked down, the
+// callers of load move on to the next holder of the key
+var errPeerDown = errors.New("geecache: peer marked down")
+
+// peer health as seen by a breaker
+const (
+	peerUp      = iota // calls go through
+	peerDown           // calls fail fast with errPeerDown until retryAt
+	peerProbing        // one call checks whether the peer is back
+)
+
+// breaker tracks whether a peer can be reached. Only transport failures
+// count: a peer answering with an error is up, and a call whose caller
+// gave up tells nothing about the peer.
+type breaker struct {
+	health   int
+	failures int       // consecutive transport failures
+	retryAt  time.Time // when a peer down is probed again
+	probing  bool      // the probe is in flight
+}
+
+// callPeer calls peer unless it's marked down, and records whether the
+// peer could be reached
+func (g *Group) callPeer(ctx context.Context, peer PeerGetter, call func() error) error {
+	if !g.admit(peer) {
+		return errPeerDown
+	}
+	err := call()
+	var perr *peerError
+	switch {
+	case err == nil, errors.As(err, &perr):
+		g.record(peer, true)
+	case ctx.Err() != nil:
+		g.abandon(peer)
+	default:
+		g.record(peer, false)
+	}
+	return err
+}
+
+// breaker returns the breaker of peer, creating it if needed. A new peer
+// means the peers were set again, the breakers of the peers dropped are
+// removed then. g.breakerMu must be held.
+func (g *Group) breaker(peer PeerGetter) *breaker {
+	b, ok := g.breakers[peer]
+	if !ok {
+		if g.breakers == nil {
+			g.breakers = make(map[PeerGetter]*breaker)
+		}
+		if len(g.breakers) > 0 && g.peers != nil {
+			peers := g.peers.Peers()
+			for p := range g.breakers {
+				if !containsPeer(peers, p) {
+					delete(g.breakers, p)
+				}
+			}
+		}
+		b = &breaker{}
+		g.breakers[peer] = b
+	}
+	return b
+}
+
+// admit reports whether a call to peer may go ahead. Once the retry time
+// of a peer down has passed, the first call admitted is its probe.
+func (g *Group) admit(peer PeerGetter) bool {
+	if g.failureThreshold <= 0 {
+		return true
+	}
+	g.breakerMu.Lock()
+	defer g.breakerMu.Unlock()
+	b := g.breaker(peer)
+	if b.health == peerUp {
+		return true
+	}
+	if b.probing || g.now().Before(b.retryAt) {
+		return false
+	}
+	b.health, b.probing = peerProbing, true
+	return true
+}
+
+// record counts a call that reached peer, or failed to. The peer is marked
+// down after failureThreshold failures in a row, or a failed probe.
+func (g *Group) record(peer PeerGetter, reached bool) {
+	if g.failureThreshold <= 0 {
+		return
+	}
+	g.breakerMu.Lock()
+	defer g.breakerMu.Unlock()
+	b := g.breaker(peer)
+	b.probing = false
+	if reached {
+		*b = breaker{}
+		return
+	}
+	b.failures++
+	if b.health == peerProbing || b.failures >= g.failureThreshold {
+		b.health = peerDown
+		b.retryAt = g.now().Add(g.openTimeout)
+	}
+}
+
+// abandon forgets a call to peer whose caller gave up. If it was the probe,
+// the next call admitted probes the peer instead.
+func (g *Group) abandon(peer PeerGetter) {
+	if g.failureThreshold <= 0 {
+		return
+	}
+	g.breakerMu.Lock()
+	defer g.breakerMu.Unlock()
+	g.breaker(peer).probing = false
+}
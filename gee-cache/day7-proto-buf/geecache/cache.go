@@ -2,34 +2,210 @@ package geecache
 
 import (
 	"geecache/lru"
+	"geecache/policy"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// cache is split into shards selected by the hash of the key, each with
+// its own lock and share of cacheBytes. A value larger than the share of
+// its shard isn't cached, so the default count keeps shards of at least
+// 1MB, larger than most values. Lookups only take the read lock and peek
+// at the policy, the keys looked up are recorded in read buffers and
+// replayed to the policy in batches, as in Caffeine. A batch is dropped
+// if the shard is busy, the policy only needs a sample of the lookups.
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
+	shards []*shard
+	mask   uint32
+}
+
+type shard struct {
+	// accessed atomically, first for 64-bit alignment
+	gets        int64
+	hits        int64
+	evictions   int64
+	expirations int64
+
+	mu         sync.RWMutex
+	policy     policy.Policy
+	newPolicy  policy.Factory
 	cacheBytes int64
+	now        func() time.Time
+	reads      sync.Pool // of *readBuffer
 }
 
-func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+const (
+	// shards of the default count hold at least minShardBytes
+	defaultShards = 16
+	minShardBytes = 1 << 20
+	readBufferLen = 64
+)
+
+// readBuffer records the keys looked up in a shard, sync.Pool gives each
+// P its own buffer so that recording doesn't contend
+type readBuffer struct {
+	keys [readBufferLen]string
+	n    int
+}
+
+// newCache returns a cache of n shards, rounded up to a power of two. If n
+// is zero, the default count is reduced for small caches.
+func newCache(cacheBytes int64, n int, newPolicy policy.Factory, now func() time.Time) cache {
+	if newPolicy == nil {
+		newPolicy = policy.NewLRU
+	}
+	if n <= 0 {
+		n = defaultShards
+		for n > 1 && cacheBytes != 0 && cacheBytes/int64(n) < minShardBytes {
+			n /= 2
+		}
+	}
+	count := 1
+	for count < n {
+		count <<= 1
+	}
+	c := cache{shards: make([]*shard, count), mask: uint32(count - 1)}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			newPolicy:  newPolicy,
+			cacheBytes: cacheBytes / int64(count),
+			now:        now,
+		}
+		c.shards[i].reads.New = func() interface{} { return new(readBuffer) }
+	}
+	return c
+}
+
+// shard returns the shard of key, by the FNV-1a hash of key
+func (c *cache) shard(key string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h&c.mask]
+}
+
+func (c *cache) add(key string, value ByteView, expire time.Time) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
+		s.policy = s.newPolicy(policy.Config{MaxBytes: s.cacheBytes, Now: s.now, OnEvicted: s.onEvicted})
+	}
+	s.policy.Add(key, value, expire)
+}
+
+func (s *shard) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	switch reason {
+	case lru.Expired:
+		atomic.AddInt64(&s.expirations, 1)
+	case lru.Evicted:
+		atomic.AddInt64(&s.evictions, 1)
+	}
+}
+
+func (c *cache) remove(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy != nil {
+		s.policy.Remove(key)
 	}
-	c.lru.Add(key, value)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	s := c.shard(key)
+	atomic.AddInt64(&s.gets, 1)
+	s.mu.RLock()
+	if s.policy == nil {
+		s.mu.RUnlock()
 		return
 	}
-
-	if v, ok := c.lru.Get(key); ok {
+	v, ok := s.policy.Peek(key)
+	s.mu.RUnlock()
+	s.record(key)
+	if ok {
+		atomic.AddInt64(&s.hits, 1)
 		return v.(ByteView), ok
 	}
-
 	return
 }
+
+// record buffers a lookup of key, and replays the buffer to the policy
+// once it's full
+func (s *shard) record(key string) {
+	b := s.reads.Get().(*readBuffer)
+	b.keys[b.n] = key
+	b.n++
+	if b.n == readBufferLen {
+		s.drain(b)
+	}
+	s.reads.Put(b)
+}
+
+// drain replays the lookups of b to the policy unless the shard is busy,
+// and empties b
+func (s *shard) drain(b *readBuffer) {
+	if s.mu.TryLock() {
+		for _, k := range b.keys[:b.n] {
+			s.policy.Get(k)
+		}
+		s.mu.Unlock()
+	}
+	b.keys = [readBufferLen]string{}
+	b.n = 0
+}
+
+func (c *cache) removeExpired() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if s.policy != nil {
+			n += s.policy.RemoveExpired()
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// resize sets the budget of c to cacheBytes in place, the shards evict
+// values until they fit their share
+func (c *cache) resize(cacheBytes int64) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.cacheBytes = cacheBytes / int64(len(c.shards))
+		if s.policy != nil {
+			s.policy.Resize(s.cacheBytes)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// CacheStats are the statistics of a cache
+type CacheStats struct {
+	Bytes       int64
+	Items       int64
+	Gets        int64
+	Hits        int64
+	Evictions   int64
+	Expirations int64
+}
+
+func (c *cache) stats() CacheStats {
+	var st CacheStats
+	for _, s := range c.shards {
+		s.mu.RLock()
+		if s.policy != nil {
+			st.Bytes += s.policy.Bytes()
+			st.Items += int64(s.policy.Len())
+		}
+		s.mu.RUnlock()
+		st.Gets += atomic.LoadInt64(&s.gets)
+		st.Hits += atomic.LoadInt64(&s.hits)
+		st.Evictions += atomic.LoadInt64(&s.evictions)
+		st.Expirations += atomic.LoadInt64(&s.expirations)
+	}
+	return st
+}
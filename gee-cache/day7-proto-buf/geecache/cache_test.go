@@ -0,0 +1,131 @@
+package geecache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheShards(t *testing.T) {
+	if c := newCache(2<<10, 0, nil, time.Now); len(c.shards) != 1 {
+		t.Fatalf("expect a single shard for a small cache, but got %d", len(c.shards))
+	}
+	if c := newCache(64<<10, 0, nil, time.Now); len(c.shards) != 1 {
+		t.Fatalf("expect a single shard for a 64KB cache, but got %d", len(c.shards))
+	}
+	if c := newCache(4<<20, 0, nil, time.Now); len(c.shards) != 4 || c.shards[0].cacheBytes != 1<<20 {
+		t.Fatalf("expect 4 shards of 1MB, but got %d", len(c.shards))
+	}
+	if c := newCache(64<<20, 0, nil, time.Now); len(c.shards) != defaultShards || c.shards[0].cacheBytes != 4<<20 {
+		t.Fatalf("expect %d shards of 4MB, but got %d", defaultShards, len(c.shards))
+	}
+	c := newCache(0, 5, nil, time.Now)
+	if len(c.shards) != 8 {
+		t.Fatalf("expect 8 shards, but got %d", len(c.shards))
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)}, time.Time{})
+	}
+	for _, s := range c.shards {
+		if n := s.policy.Len(); n < 80 || n > 170 {
+			t.Fatalf("expect keys to spread over shards, but a shard has %d", n)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := c.get(key); !ok || v.String() != key {
+			t.Fatalf("cache hit %s failed", key)
+		}
+	}
+}
+
+func TestCacheReadBuffer(t *testing.T) {
+	c := newCache(int64(len("k1v1k2v2")), 1, nil, time.Now)
+	c.add("k1", ByteView{b: []byte("v1")}, time.Time{})
+	c.add("k2", ByteView{b: []byte("v2")}, time.Time{})
+	// replaying the lookup of k1 makes it the most recent
+	c.get("k1")
+	s := c.shards[0]
+	b := &readBuffer{n: 1}
+	b.keys[0] = "k1"
+	s.drain(b)
+	if b.n != 0 || b.keys[0] != "" {
+		t.Fatal("the buffer should be emptied")
+	}
+	c.add("k3", ByteView{b: []byte("v3")}, time.Time{})
+	if _, ok := c.get("k2"); ok {
+		t.Fatal("k2 should be evicted")
+	}
+	if _, ok := c.get("k1"); !ok {
+		t.Fatal("k1 should be kept")
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	c := newCache(1<<10, 4, nil, time.Now)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa((i*j + j) % 100)
+				if _, ok := c.get(key); !ok {
+					c.add(key, ByteView{b: []byte(key)}, time.Time{})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// BenchmarkCacheGetParallel shows how lookups scale with shards, run with
+// -cpu 1,4,8
+func BenchmarkCacheGetParallel(b *testing.B) {
+	keys := make([]string, 1<<12)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			c := newCache(0, n, nil, time.Now)
+			for _, key := range keys {
+				c.add(key, ByteView{b: []byte(key)}, time.Time{})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.get(keys[i&(len(keys)-1)])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCacheMixedParallel mixes 10% of writes to the lookups
+func BenchmarkCacheMixedParallel(b *testing.B) {
+	keys := make([]string, 1<<12)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, n := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			c := newCache(1<<14, n, nil, time.Now)
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i&(len(keys)-1)]
+					if _, ok := c.get(key); !ok || i%10 == 0 {
+						c.add(key, ByteView{b: []byte(key)}, time.Time{})
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -9,12 +9,37 @@ import (
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
+// Picker picks the node of a key among a set of nodes, moving few keys
+// when the set changes. Map, Jump, Rendezvous and Maglev are Pickers.
+type Picker interface {
+	// Add adds nodes of weight 1
+	Add(nodes ...string)
+	// AddWeighted adds a node, or changes its weight. A node gets a share
+	// of the keys proportional to its weight, a weight <= 0 removes it.
+	AddWeighted(node string, weight int)
+	// Remove removes nodes
+	Remove(nodes ...string)
+	// Get returns the node of key, "" if there's no node
+	Get(key string) string
+	// GetN returns up to n distinct nodes for key, the node of Get first.
+	// The others are the nodes taking over the keys of the node before
+	// them as it's removed, as far as the algorithm allows.
+	GetN(key string, n int) []string
+}
+
 // Map constains all hashed keys
 type Map struct {
 	hash     Hash
 	replicas int
-	keys     []int // Sorted
-	hashMap  map[int]string
+	ring     []vnode // sorted by hash, then node
+	weights  map[string]int
+}
+
+// vnode is a virtual node, a point of a node on the ring. Points of
+// several nodes may collide, the point belongs to the lowest node then.
+type vnode struct {
+	hash uint32
+	node string
 }
 
 // New creates a Map instance
@@ -22,7 +47,7 @@ func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -33,26 +58,113 @@ func New(replicas int, fn Hash) *Map {
 // Add adds some keys to the hash.
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.remove(key)
+		m.add(key, 1)
+	}
+	m.sort()
+}
+
+// AddWeighted adds a node with weight times the replicas of the Map
+func (m *Map) AddWeighted(node string, weight int) {
+	m.remove(node)
+	if weight <= 0 {
+		return
+	}
+	m.add(node, weight)
+	m.sort()
+}
+
+func (m *Map) add(node string, weight int) {
+	m.weights[node] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := m.hash([]byte(strconv.Itoa(i) + node))
+		m.ring = append(m.ring, vnode{hash, node})
+	}
+}
+
+func (m *Map) sort() {
+	sort.Slice(m.ring, func(i, j int) bool {
+		if m.ring[i].hash != m.ring[j].hash {
+			return m.ring[i].hash < m.ring[j].hash
+		}
+		return m.ring[i].node < m.ring[j].node
+	})
+}
+
+// Remove removes nodes from the hash, their keys go to the next nodes
+// on the ring
+func (m *Map) Remove(nodes ...string) {
+	for _, node := range nodes {
+		m.remove(node)
+	}
+}
+
+func (m *Map) remove(node string) {
+	if _, ok := m.weights[node]; !ok {
+		return
+	}
+	delete(m.weights, node)
+	ring := m.ring[:0]
+	for _, v := range m.ring {
+		if v.node != node {
+			ring = append(ring, v)
 		}
 	}
-	sort.Ints(m.keys)
+	m.ring = ring
 }
 
 // Get gets the closest item in the hash to the provided key.
 func (m *Map) Get(key string) string {
-	if len(m.keys) == 0 {
+	if len(m.ring) == 0 {
 		return ""
 	}
 
-	hash := int(m.hash([]byte(key)))
+	hash := m.hash([]byte(key))
 	// Binary search for appropriate replica.
-	idx := sort.Search(len(m.keys), func(i int) bool {
-		return m.keys[i] >= hash
+	idx := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= hash
 	})
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+	return m.ring[idx%len(m.ring)].node
+}
+
+// GetN returns the nodes of the next points on the ring from key
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.ring) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	hash := m.hash([]byte(key))
+	idx := sort.Search(len(m.ring), func(i int) bool {
+		return m.ring[i].hash >= hash
+	})
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(m.ring) && len(nodes) < n; i++ {
+		nodes = appendNew(nodes, m.ring[(idx+i)%len(m.ring)].node)
+	}
+	return nodes
+}
+
+var _ Picker = (*Map)(nil)
+
+// appendNew appends node to nodes unless it's in already
+func appendNew(nodes []string, node string) []string {
+	for _, n := range nodes {
+		if n == node {
+			return nodes
+		}
+	}
+	return append(nodes, node)
+}
+
+// mix64 is the finalizer of SplitMix64, it spreads the bits of x
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
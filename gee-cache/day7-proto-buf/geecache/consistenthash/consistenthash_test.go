@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"fmt"
 	"strconv"
 	"testing"
 )
@@ -41,3 +42,223 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	hash.Remove("4")
+
+	testCases := map[string]string{
+		"2":  "2",
+		"3":  "6",
+		"23": "6",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+
+	hash.Remove("2", "6")
+	if got := hash.Get("2"); got != "" {
+		t.Fatalf("expect no node, but got %s", got)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// every virtual node of every node collides
+	hash := New(3, func(key []byte) uint32 {
+		return 42
+	})
+	hash.Add("b", "a")
+	if got := hash.Get("key"); got != "a" {
+		t.Fatalf("expect the lowest node a, but got %s", got)
+	}
+	hash.Remove("a")
+	if got := hash.Get("key"); got != "b" {
+		t.Fatalf("expect b to keep its points after a is removed, but got %s", got)
+	}
+}
+
+var pickers = []struct {
+	name string
+	new  func() Picker
+	// skew is the tolerated deviation from the fair share of keys, in
+	// percent. The points of a Map are unevenly spread by crc32.
+	skew int
+}{
+	{"Map", func() Picker { return New(100, nil) }, 40},
+	{"Jump", func() Picker { return NewJump(nil) }, 10},
+	{"Rendezvous", func() Picker { return NewRendezvous(nil) }, 10},
+	{"Maglev", func() Picker { return NewMaglev(0, nil) }, 10},
+}
+
+const testKeys = 50000
+
+func nodeNames(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = fmt.Sprintf("10.0.0.%d:8001", i+1)
+	}
+	return nodes
+}
+
+// assign returns the node of each key
+func assign(p Picker) []string {
+	nodes := make([]string, testKeys)
+	for i := range nodes {
+		nodes[i] = p.Get("key" + strconv.Itoa(i))
+	}
+	return nodes
+}
+
+func count(nodes []string) map[string]int {
+	counts := make(map[string]int)
+	for _, n := range nodes {
+		counts[n]++
+	}
+	return counts
+}
+
+func TestDistribution(t *testing.T) {
+	for _, pk := range pickers {
+		p := pk.new()
+		p.Add(nodeNames(10)...)
+		counts := count(assign(p))
+		fair := testKeys / 10
+		for node, n := range counts {
+			if n < fair*(100-pk.skew)/100 || n > fair*(100+pk.skew)/100 {
+				t.Errorf("%s: %s got %d keys, expect about %d", pk.name, node, n, fair)
+			}
+		}
+	}
+}
+
+func TestWeights(t *testing.T) {
+	for _, pk := range pickers {
+		p := pk.new()
+		nodes := nodeNames(4)
+		p.Add(nodes[:3]...)
+		p.AddWeighted(nodes[3], 3)
+		counts := count(assign(p))
+		// the heavy node gets half of the keys
+		if n := counts[nodes[3]]; n < testKeys*4/10 || n > testKeys*6/10 {
+			t.Errorf("%s: the node of weight 3 got %d keys, expect about %d", pk.name, n, testKeys/2)
+		}
+	}
+}
+
+// TestMovement checks that few keys move when a node is added or removed.
+// Ideally 1/11 of the keys move to an added 11th node, and only the keys
+// of a removed node move.
+func TestMovement(t *testing.T) {
+	for _, pk := range pickers {
+		nodes := nodeNames(11)
+		p := pk.new()
+		p.Add(nodes[:10]...)
+		before := assign(p)
+
+		p.Add(nodes[10])
+		after := assign(p)
+		moved, movedElsewhere := 0, 0
+		for i := range before {
+			if before[i] != after[i] {
+				moved++
+				if after[i] != nodes[10] {
+					movedElsewhere++
+				}
+			}
+		}
+		ideal := testKeys / 11
+		t.Logf("%s: adding a node moved %d keys, %d of them not to it (ideal %d)", pk.name, moved, movedElsewhere, ideal)
+		if moved > ideal*3/2 || movedElsewhere > ideal/10 {
+			t.Errorf("%s: adding a node moved %d keys, %d of them not to it, expect about %d", pk.name, moved, movedElsewhere, ideal)
+		}
+
+		// Jump can only remove the last node without moving other keys
+		removed := nodes[10]
+		if pk.name != "Jump" {
+			removed = nodes[3]
+		}
+		p.Remove(removed)
+		final := assign(p)
+		moved = 0
+		for i := range after {
+			if after[i] != final[i] && after[i] != removed {
+				moved++
+			}
+		}
+		t.Logf("%s: removing a node moved %d keys of the other nodes", pk.name, moved)
+		if moved > ideal/10 {
+			t.Errorf("%s: removing a node moved %d keys of the other nodes", pk.name, moved)
+		}
+		for i, n := range final {
+			if n == removed || n == "" {
+				t.Fatalf("%s: key%d still maps to %q", pk.name, i, n)
+			}
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for _, pk := range pickers {
+		p := pk.new()
+		if nodes := p.GetN("key", 3); len(nodes) != 0 {
+			t.Fatalf("%s: expect no nodes, but got %v", pk.name, nodes)
+		}
+		p.Add(nodeNames(5)...)
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			nodes := p.GetN(key, 3)
+			if len(nodes) != 3 || nodes[0] != p.Get(key) {
+				t.Fatalf("%s: expect 3 nodes starting with %s, but got %v", pk.name, p.Get(key), nodes)
+			}
+			if nodes[0] == nodes[1] || nodes[0] == nodes[2] || nodes[1] == nodes[2] {
+				t.Fatalf("%s: expect distinct nodes, but got %v", pk.name, nodes)
+			}
+		}
+		if nodes := p.GetN("key", 10); len(nodes) != 5 {
+			t.Fatalf("%s: expect all the 5 nodes, but got %v", pk.name, nodes)
+		}
+	}
+
+	// a weight <= 0 removes the node
+	for _, pk := range pickers {
+		for _, weight := range []int{0, -1} {
+			p := pk.new()
+			p.Add("a", "b")
+			p.AddWeighted("a", weight)
+			p.AddWeighted("c", weight)
+			if nodes := p.GetN("key", 3); len(nodes) != 1 || nodes[0] != "b" {
+				t.Fatalf("%s: expect only b after weight %d, but got %v", pk.name, weight, nodes)
+			}
+			p.Remove("b")
+			if node := p.Get("key"); node != "" {
+				t.Fatalf("%s: expect no node, but got %q", pk.name, node)
+			}
+		}
+	}
+
+	// the second node of a key takes it over as the first is removed
+	for _, p := range []Picker{New(100, nil), NewRendezvous(nil)} {
+		nodes := nodeNames(5)
+		p.Add(nodes...)
+		next := make([]string, testKeys)
+		for i := range next {
+			if n := p.GetN("key"+strconv.Itoa(i), 2); n[0] == nodes[3] {
+				next[i] = n[1]
+			}
+		}
+		p.Remove(nodes[3])
+		for i, n := range assign(p) {
+			if next[i] != "" && n != next[i] {
+				t.Fatalf("%T: expect key%d to go to %s, but got %s", p, i, next[i], n)
+			}
+		}
+	}
+}
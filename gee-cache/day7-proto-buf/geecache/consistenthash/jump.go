@@ -0,0 +1,105 @@
+package consistenthash
+
+import "hash/crc32"
+
+// Jump is the jump consistent hash of Lamping and Veach. It needs no
+// memory but a bucket per unit of weight, and spreads the keys evenly.
+// Buckets are numbered in the order the nodes are added, so removing a
+// node other than the last one moves the keys of the nodes after it.
+type Jump struct {
+	hash    Hash
+	nodes   []string // in the order added
+	weights map[string]int
+	buckets []string // the node of each bucket
+}
+
+// NewJump creates a Jump
+func NewJump(fn Hash) *Jump {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Jump{hash: fn, weights: make(map[string]int)}
+}
+
+// Add adds nodes of weight 1
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		j.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted adds a node of weight buckets, a node whose weight changes
+// becomes the last one. A weight <= 0 removes the node.
+func (j *Jump) AddWeighted(node string, weight int) {
+	if _, ok := j.weights[node]; ok {
+		j.Remove(node)
+	}
+	if weight <= 0 {
+		return
+	}
+	j.weights[node] = weight
+	j.nodes = append(j.nodes, node)
+	for i := 0; i < weight; i++ {
+		j.buckets = append(j.buckets, node)
+	}
+}
+
+// Remove removes nodes
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := j.weights[node]; !ok {
+			continue
+		}
+		delete(j.weights, node)
+		for i, n := range j.nodes {
+			if n == node {
+				j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+				break
+			}
+		}
+	}
+	j.buckets = j.buckets[:0]
+	for _, node := range j.nodes {
+		for i := 0; i < j.weights[node]; i++ {
+			j.buckets = append(j.buckets, node)
+		}
+	}
+}
+
+// Get returns the node of key
+func (j *Jump) Get(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[JumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.buckets))]
+}
+
+// GetN returns the nodes of the bucket of key and the next buckets
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.buckets) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	b := JumpHash(mix64(uint64(j.hash([]byte(key)))), len(j.buckets))
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(j.buckets) && len(nodes) < n; i++ {
+		nodes = appendNew(nodes, j.buckets[(b+i)%len(j.buckets)])
+	}
+	return nodes
+}
+
+// JumpHash returns the bucket of key among n buckets. When n grows, a
+// key either stays or moves to one of the new buckets.
+func JumpHash(key uint64, n int) int {
+	var b, i int64 = -1, 0
+	for i < int64(n) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+var _ Picker = (*Jump)(nil)
@@ -0,0 +1,136 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// DefaultMaglevSize is the size of the lookup table of a Maglev if none
+// is given, a prime
+const DefaultMaglevSize = 65537
+
+// Maglev is the consistent hashing of Google's Maglev load balancer. Each
+// node fills the slots of a lookup table in the order of its own
+// permutation, in turns, so that the nodes get nearly the same number of
+// slots and Get is a single lookup. A change of the nodes moves a few
+// more keys than strictly needed, and rebuilds the table.
+type Maglev struct {
+	hash    Hash
+	size    uint64
+	weights map[string]int
+	nodes   []string // sorted, so that the table doesn't depend on the order of Add
+	table   []int    // index in nodes of each slot, nil without nodes
+}
+
+// NewMaglev creates a Maglev whose lookup table has size slots. size must
+// be a prime, much larger than the number of nodes, DefaultMaglevSize
+// if zero.
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size == 0 {
+		size = DefaultMaglevSize
+	}
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Maglev{hash: fn, size: uint64(size), weights: make(map[string]int)}
+}
+
+// Add adds nodes of weight 1
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		m.weights[node] = 1
+	}
+	m.populate()
+}
+
+// AddWeighted adds a node, which fills weight slots per turn. A weight <= 0
+// removes the node.
+func (m *Maglev) AddWeighted(node string, weight int) {
+	if weight <= 0 {
+		delete(m.weights, node)
+	} else {
+		m.weights[node] = weight
+	}
+	m.populate()
+}
+
+// Remove removes nodes
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(m.weights, node)
+	}
+	m.populate()
+}
+
+// populate fills the lookup table
+func (m *Maglev) populate() {
+	m.nodes = m.nodes[:0]
+	for node, weight := range m.weights {
+		if weight > 0 {
+			m.nodes = append(m.nodes, node)
+		}
+	}
+	sort.Strings(m.nodes)
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+
+	// the permutation of node i is offset[i] + j*skip[i] mod size
+	offset := make([]uint64, len(m.nodes))
+	skip := make([]uint64, len(m.nodes))
+	next := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		h := mix64(uint64(m.hash([]byte(node))))
+		offset[i] = h % m.size
+		skip[i] = (h>>32)%(m.size-1) + 1
+	}
+
+	m.table = make([]int, m.size)
+	for i := range m.table {
+		m.table[i] = -1
+	}
+	for filled := uint64(0); ; {
+		for i, node := range m.nodes {
+			for turn := 0; turn < m.weights[node]; turn++ {
+				c := (offset[i] + next[i]*skip[i]) % m.size
+				for m.table[c] >= 0 {
+					next[i]++
+					c = (offset[i] + next[i]*skip[i]) % m.size
+				}
+				m.table[c] = i
+				next[i]++
+				filled++
+				if filled == m.size {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Get returns the node of the slot of key
+func (m *Maglev) Get(key string) string {
+	if len(m.table) == 0 {
+		return ""
+	}
+	return m.nodes[m.table[uint64(m.hash([]byte(key)))%m.size]]
+}
+
+// GetN returns the nodes of the slot of key and the next slots
+func (m *Maglev) GetN(key string, n int) []string {
+	if len(m.table) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	slot := uint64(m.hash([]byte(key))) % m.size
+	nodes := make([]string, 0, n)
+	for i := uint64(0); len(nodes) < n; i++ {
+		nodes = appendNew(nodes, m.nodes[m.table[(slot+i)%m.size]])
+	}
+	return nodes
+}
+
+var _ Picker = (*Maglev)(nil)
@@ -0,0 +1,120 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+// Rendezvous is the highest random weight hashing of Thaler and Ravishankar:
+// the node of a key is the node of the highest score for the key. Removing
+// a node only moves its keys, and adding one only moves keys to it, but
+// Get scores every node.
+type Rendezvous struct {
+	hash  Hash
+	nodes []hrwNode
+}
+
+type hrwNode struct {
+	name   string
+	hash   uint64
+	weight float64
+}
+
+// NewRendezvous creates a Rendezvous
+func NewRendezvous(fn Hash) *Rendezvous {
+	if fn == nil {
+		fn = crc32.ChecksumIEEE
+	}
+	return &Rendezvous{hash: fn}
+}
+
+// Add adds nodes of weight 1
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted adds a node, the scores of the node are scaled by weight. A
+// weight <= 0 removes the node.
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight <= 0 {
+		r.Remove(node)
+		return
+	}
+	for i := range r.nodes {
+		if r.nodes[i].name == node {
+			r.nodes[i].weight = float64(weight)
+			return
+		}
+	}
+	r.nodes = append(r.nodes, hrwNode{
+		name:   node,
+		hash:   uint64(r.hash([]byte(node))) << 32,
+		weight: float64(weight),
+	})
+}
+
+// Remove removes nodes
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		for i := range r.nodes {
+			if r.nodes[i].name == node {
+				r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Get returns the node of the highest score for key. The score of a node
+// is -weight/ln(h), h being the hash of the node and key in (0, 1), so
+// that the nodes win in proportion to their weights.
+func (r *Rendezvous) Get(key string) string {
+	kh := uint64(r.hash([]byte(key)))
+	best, bestScore := "", math.Inf(-1)
+	for _, n := range r.nodes {
+		score := n.score(kh)
+		if score > bestScore || (score == bestScore && n.name < best) {
+			best, bestScore = n.name, score
+		}
+	}
+	return best
+}
+
+// GetN returns the nodes of the n highest scores for key
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	kh := uint64(r.hash([]byte(key)))
+	scores := make([]float64, len(r.nodes))
+	order := make([]int, len(r.nodes))
+	for i := range r.nodes {
+		scores[i] = r.nodes[i].score(kh)
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return r.nodes[a].name < r.nodes[b].name
+	})
+	if n > len(order) {
+		n = len(order)
+	}
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = r.nodes[order[i]].name
+	}
+	return nodes
+}
+
+func (n *hrwNode) score(keyHash uint64) float64 {
+	h := (float64(mix64(n.hash|keyHash)>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(h)
+}
+
+var _ Picker = (*Rendezvous)(nil)
@@ -1,11 +1,15 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "geecache/geecachepb"
+	"geecache/policy"
 	"geecache/singleflight"
-	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 // A Group is a cache namespace and associated data loaded spread over
@@ -13,10 +17,36 @@ type Group struct {
 	name      string
 	getter    Getter
 	mainCache cache
-	peers     PeerPicker
+	// hotCache holds a sample of the values fetched from peers, so that a
+	// popular key owned by another peer doesn't cost a round trip per Get
+	hotCache cache
+	peers    PeerPicker
+	// Stats are statistics on the group
+	Stats Stats
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group
+	// peerLoader dedupes the loads for the peers apart from loader, so
+	// that they never wait on a load forwarded to a peer
+	peerLoader *singleflight.Group
+
+	ttl           time.Duration
+	jitter        time.Duration
+	sweepInterval time.Duration
+	done          chan struct{} // closed by Close to stop the sweeper
+	closeOnce     sync.Once
+	now           func() time.Time
+	newPolicy     policy.Factory
+	shards        int
+	cacheBytes    int64
+	hotFraction   float64
+	hotSample     float64
+	numHolders    int
+
+	failureThreshold int
+	openTimeout      time.Duration
+	breakerMu        sync.Mutex
+	breakers         map[PeerGetter]*breaker
 }
 
 // A Getter loads data for a key.
@@ -32,28 +62,88 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// A GetterWithContext is a Getter that gives up when ctx is done. The
+// Getter of a Group is used with the context of Get if it implements
+// GetterWithContext.
+type GetterWithContext interface {
+	Getter
+	GetWithContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// A GetterWithContextFunc implements GetterWithContext with a function.
+type GetterWithContextFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements Getter, with the background context
+func (f GetterWithContextFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// GetWithContext implements GetterWithContext interface function
+func (f GetterWithContextFunc) GetWithContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
 // NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...Option) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:          name,
+		getter:        getter,
+		cacheBytes:    cacheBytes,
+		loader:        &singleflight.Group{},
+		peerLoader:    &singleflight.Group{},
+		sweepInterval: time.Minute,
+		done:          make(chan struct{}),
+		now:           time.Now,
+		hotFraction:   1.0 / 8,
+		hotSample:     1.0 / 10,
+		numHolders:    1,
+
+		failureThreshold: 5,
+		openTimeout:      30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	// the main cache gives the hot cache its share once there are peers,
+	// the hot cache is only filled then
+	g.mainCache = newCache(cacheBytes, g.shards, g.newPolicy, g.now)
+	g.hotCache = newCache(g.hotBytes(), g.shards, g.newPolicy, g.now)
+	if g.ttl > 0 && g.sweepInterval > 0 {
+		go g.sweep()
+	}
+	if old, ok := groups[name]; ok {
+		old.stop()
 	}
 	groups[name] = g
 	return g
 }
 
+// Close stops the background work of the group and unregisters it, so
+// that GetGroup and the peers don't find it anymore. The group keeps
+// serving its own Gets.
+func (g *Group) Close() {
+	mu.Lock()
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	mu.Unlock()
+	g.stop()
+}
+
+func (g *Group) stop() {
+	g.closeOnce.Do(func() { close(g.done) })
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
@@ -63,74 +153,330 @@ func GetGroup(name string) *Group {
 	return g
 }
 
-// Get value for a key from cache
-func (g *Group) Get(key string) (ByteView, error) {
+// Get value for a key from cache, loading it unless ctx is done first
+func (g *Group) Get(ctx context.Context, key string) (ByteView, error) {
+	g.Stats.Gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+	if v, ok := g.lookupCache(key); ok {
 		return v, nil
 	}
 
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// getForPeer serves the Get of a peer from the caches or the getter,
+// never from another peer: while the membership changes the peers may
+// disagree on the owner of key, and the request would come back.
+func (g *Group) getForPeer(ctx context.Context, key string) (ByteView, error) {
+	g.Stats.Gets.Add(1)
+	if key == "" {
+		return ByteView{}, fmt.Errorf("key is required")
+	}
+
+	if v, ok := g.lookupCache(key); ok {
+		return v, nil
+	}
+
+	g.Stats.Loads.Add(1)
+	viewi, err, _ := g.peerLoader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		g.Stats.LoadsDeduped.Add(1)
+		return g.loadLocally(ctx, key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		g.Stats.CacheHits.Add(1)
+		return v, true
+	}
+	if g.hotFraction > 0 {
+		if v, ok := g.hotCache.get(key); ok {
+			g.Stats.CacheHits.Add(1)
+			return v, true
+		}
+	}
+	return ByteView{}, false
+}
+
+// Set stores value as the value of key on the peers holding key, it
+// expires after ttl, or the group's TTL if ttl is zero. The hot caches of
+// the other peers are invalidated.
+func (g *Group) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if g.peers == nil {
+		g.setLocally(key, value, ttl)
+		return nil
+	}
+	holders, pos := g.peers.PickPeers(key, g.numHolders)
+	if pos == 0 || len(holders) == 0 {
+		g.setLocally(key, value, ttl)
+		g.copyToHolders(ctx, key, value, ttl, holders)
+		return g.removeFromPeers(ctx, key, holders)
+	}
+	// the owner copies the value to the other holders
+	if pos < 0 {
+		g.hotCache.remove(key)
+	}
+	owner := holders[0]
+	req := &pb.Request{Group: g.name, Key: key, Value: value, Ttl: int64(ttl)}
+	if err := g.callPeer(ctx, owner, func() error {
+		return owner.Set(ctx, req, &pb.Response{})
+	}); err != nil {
+		return err
+	}
+	return g.removeFromPeers(ctx, key, holders)
+}
+
+// setFromPeer stores a value set by a peer, copying it to the other
+// holders of key if this peer owns it
+func (g *Group) setFromPeer(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	g.setLocally(key, value, ttl)
+	if g.peers == nil {
+		return
+	}
+	if holders, pos := g.peers.PickPeers(key, g.numHolders); pos == 0 {
+		g.copyToHolders(ctx, key, value, ttl, holders)
+	}
+}
+
+// copyTimeout limits the copies to the other holders of the values loaded,
+// which nobody waits for
+const copyTimeout = 10 * time.Second
+
+// copyToHolders copies value to peers, the holders of key other than its
+// owner. A holder failing to store it is logged, the owner has the value.
+func (g *Group) copyToHolders(ctx context.Context, key string, value []byte, ttl time.Duration, peers []PeerGetter) {
+	req := &pb.Request{Group: g.name, Key: key, Value: value, Ttl: int64(ttl)}
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if err := g.callPeer(ctx, peer, func() error {
+				return peer.Set(ctx, req, &pb.Response{})
+			}); err != nil {
+				logf("[GeeCache] Failed to copy %s/%s to peer: %v", g.name, key, err)
+			}
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// Remove removes key from the caches of all the peers, so that the next
+// Get loads it again
+func (g *Group) Remove(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	if g.peers == nil {
+		return nil
+	}
+	return g.removeFromPeers(ctx, key, nil)
+}
+
+// removeFromPeers removes key from the caches of all the peers except
+// this one and except, trying them all and returning the first error
+func (g *Group) removeFromPeers(ctx context.Context, key string, except []PeerGetter) error {
+	var first error
+	for _, peer := range g.peers.Peers() {
+		if containsPeer(except, peer) {
+			continue
+		}
+		peer := peer
+		if err := g.callPeer(ctx, peer, func() error {
+			return peer.Remove(ctx, &pb.Request{Group: g.name, Key: key}, &pb.Response{})
+		}); err != nil {
+			logf("[GeeCache] Failed to remove %s/%s from peer: %v", g.name, key, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+func containsPeer(peers []PeerGetter, peer PeerGetter) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
 }
 
-// RegisterPeers registers a PeerPicker for choosing remote peer
+func (g *Group) setLocally(key string, value []byte, ttl time.Duration) {
+	expire := g.expire()
+	if ttl > 0 {
+		expire = g.now().Add(ttl)
+	}
+	g.mainCache.add(key, ByteView{b: cloneBytes(value)}, expire)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+// RegisterPeers registers a PeerPicker for choosing remote peer. The main
+// cache shrinks in place to give the hot cache its share of the bytes,
+// evicting values if it's over its new budget.
 func (g *Group) RegisterPeers(peers PeerPicker) {
 	if g.peers != nil {
 		panic("RegisterPeerPicker called more than once")
 	}
+	g.mainCache.resize(g.cacheBytes - g.hotBytes())
 	g.peers = peers
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) hotBytes() int64 {
+	return int64(float64(g.cacheBytes) * g.hotFraction)
+}
+
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	g.Stats.Loads.Add(1)
 	// each key is only fetched once (either locally or remotely)
-	// regardless of the number of concurrent callers.
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	// regardless of the number of concurrent callers, and the fetch is
+	// canceled once they all gave up.
+	viewi, err, _ := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		g.Stats.LoadsDeduped.Add(1)
+		var holders []PeerGetter
+		pos := -1
 		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
-					return value, nil
+			holders, pos = g.peers.PickPeers(key, g.numHolders)
+		}
+		// try the holders ahead of this peer, the owner first, and the next
+		// one only if a holder can't be reached. The error of a holder
+		// serving the request is returned as is.
+		ahead := holders
+		if pos >= 0 {
+			ahead = holders[:pos]
+		}
+		for _, peer := range ahead {
+			value, err := g.getFromPeer(ctx, peer, key)
+			if err == nil {
+				g.Stats.PeerLoads.Add(1)
+				if pos > 0 {
+					// a holder keeps the values of its owner
+					g.populateCache(key, value, &g.mainCache)
+				} else if g.hotFraction > 0 && rand.Float64() < g.hotSample {
+					g.populateCache(key, value, &g.hotCache)
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+				return value, nil
+			}
+			if err == errPeerDown {
+				continue
+			}
+			g.Stats.PeerErrors.Add(1)
+			logf("[GeeCache] Failed to get %s/%s from peer: %v", g.name, key, err)
+			var perr *peerError
+			if ctx.Err() != nil || errors.As(err, &perr) {
+				return nil, err
 			}
 		}
 
-		return g.getLocally(key)
+		value, err := g.loadLocally(ctx, key)
+		if err == nil && pos == 0 && len(holders) > 0 {
+			// copy the value to the other holders without holding up the callers
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), copyTimeout)
+				defer cancel()
+				g.copyToHolders(ctx, key, value.ByteSlice(), 0, holders)
+			}()
+		}
+		return value, err
 	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
 
-	if err == nil {
-		return viewi.(ByteView), nil
+// loadLocally gets the value of key from the getter, counting the load
+func (g *Group) loadLocally(ctx context.Context, key string) (ByteView, error) {
+	value, err := g.getLocally(ctx, key)
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		return ByteView{}, err
 	}
-	return
+	g.Stats.LocalLoads.Add(1)
+	return value, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+func (g *Group) populateCache(key string, value ByteView, cache *cache) {
+	cache.add(key, value, g.expire())
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var bytes []byte
+	var err error
+	if getter, ok := g.getter.(GetterWithContext); ok {
+		bytes, err = getter.GetWithContext(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 
 	}
 	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	g.populateCache(key, value, &g.mainCache)
 	return value, nil
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := g.callPeer(ctx, peer, func() error {
+		return peer.Get(ctx, req, res)
+	})
 	if err != nil {
 		return ByteView{}, err
 	}
 	return ByteView{b: res.Value}, nil
 }
+
+// CacheType is the type of a cache of a Group
+type CacheType int
+
+const (
+	// MainCache holds the values the group is the owner of
+	MainCache CacheType = iota + 1
+	// HotCache holds popular values owned by other peers
+	HotCache
+)
+
+// CacheStats returns the statistics of a cache of the group
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	}
+	return CacheStats{}
+}
+
+// allGroups returns the groups created with NewGroup
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	return all
+}
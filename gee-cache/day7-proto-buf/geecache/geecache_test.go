@@ -1,12 +1,21 @@
 package geecache
 
 import (
+	"context"
 	"fmt"
+	pb "geecache/geecachepb"
+	"geecache/policy"
 	"log"
+	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+var dummyCtx = context.Background()
+
 var db = map[string]string{
 	"Tom":  "630",
 	"Jack": "589",
@@ -40,15 +49,15 @@ func TestGet(t *testing.T) {
 		}))
 
 	for k, v := range db {
-		if view, err := gee.Get(k); err != nil || view.String() != v {
+		if view, err := gee.Get(dummyCtx, k); err != nil || view.String() != v {
 			t.Fatal("failed to get value of Tom")
 		}
-		if _, err := gee.Get(k); err != nil || loadCounts[k] > 1 {
+		if _, err := gee.Get(dummyCtx, k); err != nil || loadCounts[k] > 1 {
 			t.Fatalf("cache %s miss", k)
 		}
 	}
 
-	if view, err := gee.Get("unknown"); err == nil {
+	if view, err := gee.Get(dummyCtx, "unknown"); err == nil {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
@@ -65,3 +74,575 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but %s got", group.name)
 	}
 }
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	loads := 0
+	gee := NewGroup("ttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(fmt.Sprint(loads)), nil
+		}), WithTTL(time.Minute, 10*time.Second), WithSweepInterval(0), WithClock(func() time.Time { return now }))
+
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "1" {
+		t.Fatalf("expect 1, but got %s", view)
+	}
+	now = now.Add(time.Minute - time.Second)
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "1" {
+		t.Fatalf("expect cached 1 before expiry, but got %s", view)
+	}
+	now = now.Add(11 * time.Second)
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "2" {
+		t.Fatalf("expect 2 to be loaded after expiry, but got %s", view)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := gee.mainCache.removeExpired(); n != 1 {
+		t.Fatalf("expect 1 expired value to be removed, but got %d", n)
+	}
+}
+
+func TestTTLJitter(t *testing.T) {
+	now := time.Now()
+	g := &Group{ttl: time.Minute, jitter: time.Second, now: func() time.Time { return now }}
+	seen := make(map[time.Time]bool)
+	for i := 0; i < 20; i++ {
+		expire := g.expire()
+		if expire.Before(now.Add(time.Minute)) || !expire.Before(now.Add(time.Minute+time.Second)) {
+			t.Fatalf("expect expiry in [1m, 1m1s), but got %v", expire.Sub(now))
+		}
+		seen[expire] = true
+	}
+	if len(seen) < 2 {
+		t.Fatal("expect expiries to be spread by jitter")
+	}
+	if expire := (&Group{now: time.Now}).expire(); !expire.IsZero() {
+		t.Fatalf("expect no expiry without ttl, but got %v", expire)
+	}
+}
+
+// items returns the number of values in c
+func items(c *cache) int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.RLock()
+		if s.policy != nil {
+			n += s.policy.Len()
+		}
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+func TestLargeValue(t *testing.T) {
+	loads := 0
+	gee := NewGroup("large", 64<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return make([]byte, 5<<10), nil
+		}))
+	gee.Get(dummyCtx, "Tom")
+	gee.Get(dummyCtx, "Tom")
+	if n := items(&gee.mainCache); loads != 1 || n != 1 {
+		t.Fatalf("expect a 5KB value to be cached, but got %d loads and %d items", loads, n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	open := NewGroup("close-open", 2<<10, getter, WithTTL(time.Minute, 0), WithSweepInterval(5*time.Millisecond), WithClock(clock))
+	defer open.Close()
+	closed := NewGroup("close", 2<<10, getter, WithTTL(time.Minute, 0), WithSweepInterval(5*time.Millisecond), WithClock(clock))
+	closed.Close()
+	closed.Close()
+	if GetGroup("close") != nil {
+		t.Fatal("expect a closed group to be unregistered")
+	}
+
+	open.Get(dummyCtx, "Tom")
+	closed.Get(dummyCtx, "Tom")
+	mu.Lock()
+	now = now.Add(time.Hour)
+	mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for items(&open.mainCache) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expect the sweeper of an open group to remove expired values")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := items(&closed.mainCache); n != 1 {
+		t.Fatalf("expect the sweeper of a closed group to be stopped, but got %d items", n)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	gee := NewGroup("policy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(policy.NewTinyLFU))
+	if view, err := gee.Get(dummyCtx, "Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("expect Tom, but got %s %v", view, err)
+	}
+	if _, ok := gee.mainCache.shards[0].policy.(*policy.TinyLFU); !ok {
+		t.Fatalf("expect W-TinyLFU, but got %T", gee.mainCache.shards[0].policy)
+	}
+}
+
+type fakePeer struct {
+	gets, sets, removes int
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	out.Value = []byte("peer:" + in.Key)
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.sets++
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.removes++
+	return nil
+}
+
+func (p *fakePeer) PickPeer(key string) (PeerGetter, bool) {
+	return p, true
+}
+
+func (p *fakePeer) PickPeers(key string, n int) ([]PeerGetter, int) {
+	return []PeerGetter{p}, -1
+}
+
+func (p *fakePeer) Peers() []PeerGetter {
+	return []PeerGetter{p}
+}
+
+func TestHotCache(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+	peer := &fakePeer{}
+	gee := NewGroup("hot", 2<<10, getter, WithHotCache(0.5, 1))
+	gee.RegisterPeers(peer)
+	for i := 0; i < 3; i++ {
+		if view, err := gee.Get(dummyCtx, "Tom"); err != nil || view.String() != "peer:Tom" {
+			t.Fatalf("expect peer:Tom, but got %s %v", view, err)
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("expect a single peer load, but got %d", peer.gets)
+	}
+	hot, main := gee.CacheStats(HotCache), gee.CacheStats(MainCache)
+	if hot.Items != 1 || hot.Hits != 2 || hot.Bytes != int64(len("Tompeer:Tom")) || main.Items != 0 {
+		t.Fatalf("expect Tom in the hot cache only, but got hot %+v main %+v", hot, main)
+	}
+	if n := gee.hotCache.shards[0].cacheBytes * int64(len(gee.hotCache.shards)); n != 1<<10 {
+		t.Fatalf("expect half of the bytes for the hot cache, but got %d", n)
+	}
+
+	peer = &fakePeer{}
+	gee = NewGroup("cold", 2<<10, getter, WithHotCache(0, 0))
+	gee.RegisterPeers(peer)
+	gee.Get(dummyCtx, "Tom")
+	gee.Get(dummyCtx, "Tom")
+	if peer.gets != 2 || gee.CacheStats(HotCache).Items != 0 {
+		t.Fatalf("expect no hot cache, but got %d peer loads", peer.gets)
+	}
+
+	// without peers the main cache keeps all the bytes
+	gee = NewGroup("alone", 2<<10, getter)
+	if n := gee.mainCache.shards[0].cacheBytes * int64(len(gee.mainCache.shards)); n != 2<<10 {
+		t.Fatalf("expect all the bytes for the main cache, but got %d", n)
+	}
+
+	// out of range fractions and samples are clamped
+	gee = NewGroup("clamped", 2<<10, getter, WithHotCache(1, 2))
+	if gee.hotFraction != 0.5 || gee.hotSample != 1 {
+		t.Fatalf("expect a fraction of 0.5 and a sample of 1, but got %v %v", gee.hotFraction, gee.hotSample)
+	}
+	gee = NewGroup("negative", 2<<10, getter, WithHotCache(-1, -1))
+	if gee.hotFraction != 0 || gee.hotSample != 0 {
+		t.Fatalf("expect a fraction and a sample of 0, but got %v %v", gee.hotFraction, gee.hotSample)
+	}
+}
+
+func TestRegisterPeersResize(t *testing.T) {
+	gee := NewGroup("resize", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(time.Minute, 0), WithSweepInterval(time.Millisecond), WithHotCache(0.5, 1))
+	defer gee.Close()
+	gee.Get(dummyCtx, "Tom")
+	time.Sleep(5 * time.Millisecond)
+	gee.RegisterPeers(&fakePeer{})
+	time.Sleep(5 * time.Millisecond)
+	if n := gee.mainCache.shards[0].cacheBytes * int64(len(gee.mainCache.shards)); n != 1<<10 {
+		t.Fatalf("expect half of the bytes left for the main cache, but got %d", n)
+	}
+	if n := gee.CacheStats(MainCache).Items; n != 1 {
+		t.Fatalf("expect the values cached to be kept, but got %d items", n)
+	}
+}
+
+type errPeer struct{}
+
+func (errPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("peer down")
+}
+
+func (errPeer) Set(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("peer down")
+}
+
+func (errPeer) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return fmt.Errorf("peer down")
+}
+
+func (p errPeer) PickPeer(key string) (PeerGetter, bool) { return p, true }
+
+func (p errPeer) PickPeers(key string, n int) ([]PeerGetter, int) { return []PeerGetter{p}, -1 }
+
+func (p errPeer) Peers() []PeerGetter { return []PeerGetter{p} }
+
+type bufLogger struct {
+	lines []string
+}
+
+func (l *bufLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestStats(t *testing.T) {
+	l := &bufLogger{}
+	SetLogger(l)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+
+	gee := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	gee.RegisterPeers(errPeer{})
+	gee.Get(dummyCtx, "Tom")
+	gee.Get(dummyCtx, "Tom")
+	gee.Get(dummyCtx, "unknown")
+
+	st := &gee.Stats
+	expect := map[string]int64{
+		"Gets": 3, "CacheHits": 1, "Loads": 2, "LoadsDeduped": 2, "PeerLoads": 0,
+		"PeerErrors": 2, "LocalLoads": 1, "LocalLoadErrs": 1,
+	}
+	got := map[string]int64{
+		"Gets": st.Gets.Get(), "CacheHits": st.CacheHits.Get(), "Loads": st.Loads.Get(),
+		"LoadsDeduped": st.LoadsDeduped.Get(), "PeerLoads": st.PeerLoads.Get(), "PeerErrors": st.PeerErrors.Get(),
+		"LocalLoads": st.LocalLoads.Get(), "LocalLoadErrs": st.LocalLoadErrs.Get(),
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Fatalf("expect stats %v, but got %v", expect, got)
+	}
+	if len(l.lines) != 2 || !strings.Contains(l.lines[0], "peer down") {
+		t.Fatalf("expect peer errors to be logged, but got %q", l.lines)
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	loads := 0
+	gee := NewGroup("set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db"), nil
+		}), WithSweepInterval(0), WithClock(func() time.Time { return now }))
+
+	if err := gee.Set(dummyCtx, "Tom", []byte("630"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "630" || loads != 0 {
+		t.Fatalf("expect the value set, but got %s after %d loads", view, loads)
+	}
+	now = now.Add(time.Minute)
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "db" || loads != 1 {
+		t.Fatalf("expect the value set to expire, but got %s", view)
+	}
+	if err := gee.Remove(dummyCtx, "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if gee.Get(dummyCtx, "Tom"); loads != 2 {
+		t.Fatalf("expect Tom to be loaded again after Remove, but got %d loads", loads)
+	}
+
+	peer := &fakePeer{}
+	remote := NewGroup("set-remote", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCache(0.5, 1))
+	remote.RegisterPeers(peer)
+	remote.Get(dummyCtx, "Tom")
+	if err := remote.Set(dummyCtx, "Tom", []byte("630"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if peer.sets != 1 || remote.CacheStats(MainCache).Items != 0 || remote.CacheStats(HotCache).Items != 0 {
+		t.Fatalf("expect the value to be set on the owner only, but got %d sets", peer.sets)
+	}
+	// the owner isn't told to remove the value it was just set
+	if peer.removes != 0 {
+		t.Fatalf("expect no remove, but got %d", peer.removes)
+	}
+	if err := remote.Remove(dummyCtx, "Tom"); err != nil || peer.removes != 1 {
+		t.Fatalf("expect Remove to be broadcast, but got %d removes %v", peer.removes, err)
+	}
+
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	down := NewGroup("set-down", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	down.RegisterPeers(errPeer{})
+	if err := down.Set(dummyCtx, "Tom", []byte("630"), 0); err == nil {
+		t.Fatal("expect an error when the owner is down")
+	}
+	if err := down.Remove(dummyCtx, "Tom"); err == nil {
+		t.Fatal("expect an error when a peer is down")
+	}
+}
+
+// ring is a PeerPicker of the same holders for every key, this peer
+// being at pos among them
+type ring struct {
+	holders []PeerGetter
+	pos     int
+}
+
+func (r *ring) PickPeer(key string) (PeerGetter, bool) {
+	return r.holders[0], r.pos != 0
+}
+
+func (r *ring) PickPeers(key string, n int) ([]PeerGetter, int) {
+	return r.holders, r.pos
+}
+
+func (r *ring) Peers() []PeerGetter {
+	return r.holders
+}
+
+// setPeer sends the values set on it
+type setPeer struct {
+	fakePeer
+	set chan string
+}
+
+func (p *setPeer) Set(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.set <- in.Key + "=" + string(in.Value)
+	return nil
+}
+
+func TestHolders(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("db:" + key), nil
+	})
+
+	// the owner copies the values it loads or is set to the holders
+	set := make(chan string, 4)
+	holders := []PeerGetter{&setPeer{set: set}, &setPeer{set: set}}
+	owner := NewGroup("holders-owner", 2<<10, getter, WithHolders(3))
+	owner.RegisterPeers(&ring{holders, 0})
+	if view, err := owner.Get(dummyCtx, "Tom"); err != nil || view.String() != "db:Tom" {
+		t.Fatalf("expect db:Tom, but got %s %v", view, err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case kv := <-set:
+			if kv != "Tom=db:Tom" {
+				t.Fatalf("expect Tom to be copied, but got %s", kv)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expect the value loaded to be copied to 2 holders")
+		}
+	}
+	if err := owner.Set(dummyCtx, "Sam", []byte("567"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(set) != 2 || <-set != "Sam=567" {
+		t.Fatal("expect the value set to be copied to 2 holders")
+	}
+	for _, r := range holders {
+		if n := r.(*setPeer).removes; n != 0 {
+			t.Fatalf("expect the holders not to be told to remove the value, but got %d removes", n)
+		}
+	}
+
+	// a holder keeps the values of its owner
+	up := &fakePeer{}
+	holder := NewGroup("holders-holder", 2<<10, getter, WithHolders(2))
+	holder.RegisterPeers(&ring{[]PeerGetter{up}, 1})
+	holder.Get(dummyCtx, "Tom")
+	if view, err := holder.Get(dummyCtx, "Tom"); err != nil || view.String() != "peer:Tom" || up.gets != 1 {
+		t.Fatalf("expect peer:Tom from the main cache, but got %s %v after %d peer loads", view, err, up.gets)
+	}
+	// and loads the values itself while the owner is down
+	holder = NewGroup("holders-orphan", 2<<10, getter, WithHolders(2))
+	holder.RegisterPeers(&ring{[]PeerGetter{errPeer{}}, 1})
+	if view, err := holder.Get(dummyCtx, "Tom"); err != nil || view.String() != "db:Tom" {
+		t.Fatalf("expect db:Tom, but got %s %v", view, err)
+	}
+
+	// other peers fail over from the owner to the holders
+	up = &fakePeer{}
+	other := NewGroup("holders-other", 2<<10, getter, WithHolders(2), WithHotCache(0, 0))
+	other.RegisterPeers(&ring{[]PeerGetter{errPeer{}, up}, -1})
+	if view, err := other.Get(dummyCtx, "Tom"); err != nil || view.String() != "peer:Tom" {
+		t.Fatalf("expect peer:Tom from the holder, but got %s %v", view, err)
+	}
+	if st := &other.Stats; st.PeerErrors.Get() != 1 || st.PeerLoads.Get() != 1 || st.LocalLoads.Get() != 0 {
+		t.Fatalf("expect a peer error then a peer load, but got %+v", st)
+	}
+}
+
+// flakyPeer fails with err unless it's nil
+type flakyPeer struct {
+	fakePeer
+	err error
+}
+
+func (p *flakyPeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	if p.err != nil {
+		return p.err
+	}
+	out.Value = []byte("flaky:" + in.Key)
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	flaky, backup := &flakyPeer{err: fmt.Errorf("peer down")}, &fakePeer{}
+	gee := NewGroup("breaker", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHolders(2), WithHotCache(0, 0), WithBreaker(2, time.Minute),
+		WithClock(func() time.Time { return now }))
+	gee.RegisterPeers(&ring{[]PeerGetter{flaky, backup}, -1})
+	get := func(expect string, gets int) {
+		t.Helper()
+		if view, err := gee.Get(dummyCtx, "Tom"); err != nil || view.String() != expect || flaky.gets != gets {
+			t.Fatalf("expect %s after %d gets of the flaky peer, but got %s %v after %d", expect, gets, view, err, flaky.gets)
+		}
+	}
+
+	// the peer is marked down after 2 failures, and skipped then
+	get("peer:Tom", 1)
+	get("peer:Tom", 2)
+	get("peer:Tom", 2)
+	// a failed probe marks it down again
+	now = now.Add(time.Minute)
+	get("peer:Tom", 3)
+	get("peer:Tom", 3)
+	// a probe reaching it marks it up
+	now = now.Add(time.Minute)
+	flaky.err = nil
+	get("flaky:Tom", 4)
+	get("flaky:Tom", 5)
+
+	// errors of a peer serving the request are returned, and don't mark
+	// it down
+	flaky.err = &peerError{"500 Internal Server Error"}
+	backups := backup.gets
+	for i := 6; i < 10; i++ {
+		if _, err := gee.Get(dummyCtx, "Tom"); err != flaky.err || flaky.gets != i || backup.gets != backups {
+			t.Fatalf("expect the error of the peer after %d gets, but got %v after %d", i, err, flaky.gets)
+		}
+	}
+
+	// the breakers of the peers dropped go once a new peer is seen
+	peers := gee.peers.(*ring)
+	other := &fakePeer{}
+	peers.holders = []PeerGetter{other, backup}
+	gee.Get(dummyCtx, "Jack")
+	gee.breakerMu.Lock()
+	_, stale := gee.breakers[flaky]
+	_, fresh := gee.breakers[other]
+	gee.breakerMu.Unlock()
+	if stale || !fresh {
+		t.Fatalf("expect the breaker of the dropped peer to be removed, but got %v %v", stale, fresh)
+	}
+}
+
+func TestBreakerProbe(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	gee := NewGroup("probe", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithBreaker(1, time.Second),
+		WithClock(func() time.Time { return now }))
+	peer := &fakePeer{}
+	calls := 0
+	call := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	gee.callPeer(dummyCtx, peer, call(fmt.Errorf("connection refused")))
+	if err := gee.callPeer(dummyCtx, peer, call(nil)); err != errPeerDown || calls != 1 {
+		t.Fatalf("expect the peer to be marked down, but got %v after %d calls", err, calls)
+	}
+
+	// the caller of the probe gives up: other calls are held off meanwhile,
+	// and the next one probes the peer
+	now = now.Add(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	gee.callPeer(ctx, peer, func() error {
+		if err := gee.callPeer(dummyCtx, peer, call(nil)); err != errPeerDown {
+			t.Fatalf("expect a single probe, but got %v", err)
+		}
+		cancel()
+		return ctx.Err()
+	})
+	// a peer answering the probe with an error is up
+	gee.callPeer(dummyCtx, peer, call(&peerError{"404 Not Found"}))
+	if err := gee.callPeer(dummyCtx, peer, call(nil)); err != nil || calls != 3 {
+		t.Fatalf("expect the peer to be up, but got %v after %d calls", err, calls)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	canceled := make(chan struct{})
+	gee := NewGroup("ctx", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := gee.Get(ctx, "Tom"); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expect the getter of the abandoned load to be canceled")
+	}
+}
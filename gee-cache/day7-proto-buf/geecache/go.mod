@@ -1,5 +1,5 @@
 module geecache
 
-go 1.13
+go 1.21
 
 require github.com/golang/protobuf v1.3.3
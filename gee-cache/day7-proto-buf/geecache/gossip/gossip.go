@@ -0,0 +1,633 @@
+// Package gossip implements the SWIM membership protocol of Das, Gupta and
+// Motivala over UDP, so that the peers of a cache discover each other and
+// notice failures without a registry.
+//
+// Every probe interval, a node pings the next member in a random round
+// robin order. Without an ack in the probe timeout, it asks a few other
+// members to ping it too. Without any ack by the end of the interval the
+// member is suspected, and it is declared dead unless it refutes the
+// suspicion, by a newer incarnation, in the suspicion timeout. Updates of
+// the members are piggybacked on the pings and acks. Dead and left members
+// are forgotten after the reclaim timeout.
+//
+// The packets aren't authenticated: anyone who can send to the gossip port
+// can add members, and the names of the members given to OnChange become
+// the peers of a cache. Gossip on a private network only.
+package gossip
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the state of a member
+type State int
+
+const (
+	// Alive members answer the probes
+	Alive State = iota
+	// Suspect members missed a probe, they're still members
+	Suspect
+	// Dead members missed probes for the suspicion timeout
+	Dead
+	// Left members left the cluster
+	Left
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	case Left:
+		return "left"
+	}
+	return "unknown"
+}
+
+// member reports whether a member of state s belongs to the cluster
+func (s State) member() bool {
+	return s == Alive || s == Suspect
+}
+
+// Member is a node of the cluster
+type Member struct {
+	// Name identifies the node, e.g. the address of its cache peer
+	Name string `json:"n"`
+	// Addr is the gossip address of the node
+	Addr  string `json:"a"`
+	State State  `json:"s"`
+	// Incarnation orders the updates of the member, only the member
+	// itself increments it, to refute a suspicion
+	Incarnation uint64 `json:"i"`
+}
+
+// Config configures a Node
+type Config struct {
+	// Name identifies the node in the cluster
+	Name string
+	// BindAddr is the UDP address to listen on, e.g. "10.0.0.1:7946"
+	BindAddr string
+	// AdvertiseAddr is the gossip address of the node told to the
+	// others, the address bound if empty. It's required if BindAddr
+	// has no host or an unspecified one, e.g. "0.0.0.0:7946".
+	AdvertiseAddr string
+	// ProbeInterval is the time between probes, 1s if zero
+	ProbeInterval time.Duration
+	// ProbeTimeout is the time to wait for the ack of a ping before
+	// probing indirectly, 500ms if zero
+	ProbeTimeout time.Duration
+	// SuspicionTimeout is the time a suspect has to refute the
+	// suspicion before it's declared dead, 5s if zero
+	SuspicionTimeout time.Duration
+	// ReclaimTimeout is the time dead and left members are remembered,
+	// so that older updates don't bring them back, 6 times the
+	// suspicion timeout if zero
+	ReclaimTimeout time.Duration
+	// IndirectChecks is the number of members asked to ping a member
+	// missing an ack, 3 if zero
+	IndirectChecks int
+	// RetransmitMult scales the number of times an update is
+	// piggybacked, by log(members), 4 if zero
+	RetransmitMult int
+	// OnChange is optional and called with the names of the members,
+	// including this node, whenever they change. HTTPPool.Set and
+	// TCPPool.Set of geecache are suitable.
+	OnChange func(names ...string)
+}
+
+type msgType uint8
+
+const (
+	pingMsg msgType = iota + 1
+	pingReqMsg
+	ackMsg
+	syncMsg
+	syncReplyMsg
+)
+
+// message is the JSON of a packet. Members are the piggybacked updates,
+// or the full state of the sender for sync messages.
+type message struct {
+	Type    msgType  `json:"t"`
+	Seq     uint64   `json:"q,omitempty"`
+	Target  string   `json:"g,omitempty"` // the member to ping of pingReq
+	Members []Member `json:"m,omitempty"`
+}
+
+const (
+	maxPacket    = 65507
+	maxPiggyback = 16
+)
+
+// Node is a member of a cluster
+type Node struct {
+	cfg  Config
+	conn *net.UDPConn
+	addr string
+
+	mu         sync.Mutex // guards the fields below
+	members    map[string]*member
+	probeOrder []string
+	probeIdx   int
+	seq        uint64
+	acks       map[uint64]func()
+	broadcasts []*broadcast
+	left       bool
+
+	changed   chan struct{}
+	done      chan struct{} // closed by Close to stop the loops
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+type member struct {
+	Member
+	suspected time.Time
+	down      time.Time // when it died or left
+}
+
+// broadcast is an update to piggyback
+type broadcast struct {
+	m         Member
+	transmits int
+}
+
+// New starts a node, alone in its cluster until it joins another node.
+func New(cfg *Config) (*Node, error) {
+	n := &Node{
+		cfg:     *cfg,
+		members: make(map[string]*member),
+		acks:    make(map[uint64]func()),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if n.cfg.Name == "" {
+		return nil, errors.New("gossip: Name is required")
+	}
+	if n.cfg.ProbeInterval == 0 {
+		n.cfg.ProbeInterval = time.Second
+	}
+	if n.cfg.ProbeTimeout == 0 {
+		n.cfg.ProbeTimeout = n.cfg.ProbeInterval / 2
+	}
+	if n.cfg.SuspicionTimeout == 0 {
+		n.cfg.SuspicionTimeout = 5 * n.cfg.ProbeInterval
+	}
+	if n.cfg.ReclaimTimeout == 0 {
+		n.cfg.ReclaimTimeout = 6 * n.cfg.SuspicionTimeout
+	}
+	if n.cfg.IndirectChecks == 0 {
+		n.cfg.IndirectChecks = 3
+	}
+	if n.cfg.RetransmitMult == 0 {
+		n.cfg.RetransmitMult = 4
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", n.cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	n.conn, err = net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	n.addr = n.cfg.AdvertiseAddr
+	if n.addr == "" {
+		local := n.conn.LocalAddr().(*net.UDPAddr)
+		if local.IP == nil || local.IP.IsUnspecified() {
+			n.conn.Close()
+			return nil, errors.New("gossip: AdvertiseAddr is required when BindAddr has no host")
+		}
+		n.addr = local.String()
+	}
+	n.members[n.cfg.Name] = &member{Member: Member{Name: n.cfg.Name, Addr: n.addr, State: Alive}}
+	n.notify()
+
+	n.wg.Add(3)
+	go n.readLoop()
+	go n.probeLoop()
+	go n.notifyLoop()
+	return n, nil
+}
+
+// Addr returns the gossip address of the node
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+// Join exchanges the full state with the nodes at the gossip addresses
+// seeds, and returns how many answered. It fails if none did.
+func (n *Node) Join(seeds ...string) (int, error) {
+	joined := 0
+	var err error
+	for _, seed := range seeds {
+		seq, acked := n.expectAck()
+		if err = n.send(seed, &message{Type: syncMsg, Seq: seq, Members: n.state()}); err != nil {
+			n.forgetAck(seq)
+			continue
+		}
+		select {
+		case <-acked:
+			joined++
+		case <-time.After(n.cfg.ProbeInterval):
+			n.forgetAck(seq)
+			err = errors.New("gossip: no answer from " + seed)
+		case <-n.done:
+			return joined, errors.New("gossip: node closed")
+		}
+	}
+	if joined == 0 {
+		return 0, err
+	}
+	return joined, nil
+}
+
+// Members returns the alive and suspect members, this node included,
+// sorted by name
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var members []Member
+	for _, m := range n.members {
+		if m.State.member() {
+			members = append(members, m.Member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// Leave tells the members that this node leaves, and closes it. The
+// other nodes remove it at once rather than after suspecting it.
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	self := n.members[n.cfg.Name]
+	self.State = Left
+	self.Incarnation++
+	n.left = true
+	var addrs []string
+	for _, m := range n.members {
+		if m.Name != n.cfg.Name && m.State.member() {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+	update := self.Member
+	n.mu.Unlock()
+
+	for _, addr := range addrs {
+		n.send(addr, &message{Type: pingMsg, Members: []Member{update}})
+	}
+	return n.Close()
+}
+
+// Close stops the node without telling the others, which then notice it
+// as a failure
+func (n *Node) Close() error {
+	var err error
+	n.closeOnce.Do(func() {
+		close(n.done)
+		err = n.conn.Close()
+		n.wg.Wait()
+	})
+	return err
+}
+
+func (n *Node) readLoop() {
+	defer n.wg.Done()
+	buf := make([]byte, maxPacket)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-n.done:
+				return
+			default:
+				continue
+			}
+		}
+		msg := &message{}
+		if err := json.Unmarshal(buf[:size], msg); err != nil {
+			continue
+		}
+		n.handle(msg, from.String())
+	}
+}
+
+func (n *Node) handle(msg *message, from string) {
+	for _, m := range msg.Members {
+		n.apply(m)
+	}
+	switch msg.Type {
+	case pingMsg:
+		if msg.Seq != 0 {
+			n.send(from, &message{Type: ackMsg, Seq: msg.Seq, Members: n.piggyback()})
+		}
+	case pingReqMsg:
+		// ping the target on behalf of from, and forward its ack
+		seq := msg.Seq
+		n.mu.Lock()
+		n.seq++
+		forward := n.seq
+		n.acks[forward] = func() {
+			n.send(from, &message{Type: ackMsg, Seq: seq, Members: n.piggyback()})
+		}
+		n.mu.Unlock()
+		time.AfterFunc(n.cfg.ProbeInterval, func() { n.forgetAck(forward) })
+		n.send(msg.Target, &message{Type: pingMsg, Seq: forward, Members: n.piggyback()})
+	case ackMsg, syncReplyMsg:
+		n.mu.Lock()
+		ack, ok := n.acks[msg.Seq]
+		delete(n.acks, msg.Seq)
+		n.mu.Unlock()
+		if ok {
+			ack()
+		}
+	case syncMsg:
+		n.send(from, &message{Type: syncReplyMsg, Seq: msg.Seq, Members: n.state()})
+	}
+}
+
+// apply merges an update of a member, and queues it for gossip if it's
+// news. Updates of this node saying it's not alive are refuted.
+func (n *Node) apply(u Member) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if u.Name == n.cfg.Name {
+		self := n.members[n.cfg.Name]
+		if !n.left && u.Incarnation >= self.Incarnation && (u.State != Alive || u.Incarnation > self.Incarnation) {
+			self.Incarnation = u.Incarnation + 1
+			n.queue(self.Member)
+		}
+		return
+	}
+
+	m, ok := n.members[u.Name]
+	if !ok {
+		m = &member{Member: u}
+		n.members[u.Name] = m
+		if u.State == Suspect {
+			m.suspected = time.Now()
+		}
+		if !u.State.member() {
+			m.down = time.Now()
+		}
+		n.queue(u)
+		if u.State.member() {
+			n.notify()
+		}
+		return
+	}
+	switch u.State {
+	case Alive:
+		if u.Incarnation <= m.Incarnation {
+			return
+		}
+	case Suspect:
+		if u.Incarnation < m.Incarnation || (u.Incarnation == m.Incarnation && m.State != Alive) {
+			return
+		}
+	default:
+		if u.Incarnation < m.Incarnation || (u.Incarnation == m.Incarnation && !m.State.member()) {
+			return
+		}
+	}
+	wasMember := m.State.member()
+	m.Member = u
+	if u.State == Suspect {
+		m.suspected = time.Now()
+	}
+	if wasMember && !u.State.member() {
+		m.down = time.Now()
+	}
+	n.queue(u)
+	if wasMember != u.State.member() {
+		n.notify()
+	}
+}
+
+// queue queues an update for gossip, replacing the older update of the
+// member. n.mu must be held.
+func (n *Node) queue(m Member) {
+	for i, b := range n.broadcasts {
+		if b.m.Name == m.Name {
+			n.broadcasts = append(n.broadcasts[:i], n.broadcasts[i+1:]...)
+			break
+		}
+	}
+	n.broadcasts = append(n.broadcasts, &broadcast{m: m})
+}
+
+// piggyback returns the updates to gossip with a message, each is sent
+// RetransmitMult * log(members) times
+func (n *Node) piggyback() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	limit := n.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+1))))
+	var updates []Member
+	kept := n.broadcasts[:0]
+	for _, b := range n.broadcasts {
+		if len(updates) < maxPiggyback {
+			updates = append(updates, b.m)
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	n.broadcasts = kept
+	return updates
+}
+
+// state returns all the members known, for sync messages
+func (n *Node) state() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	state := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		state = append(state, m.Member)
+	}
+	return state
+}
+
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.reapSuspects()
+			n.probe()
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// probe pings the next member, and suspects it without an ack
+func (n *Node) probe() {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+	seq, acked := n.expectAck()
+	defer n.forgetAck(seq)
+	n.send(target.Addr, &message{Type: pingMsg, Seq: seq, Members: n.piggyback()})
+	select {
+	case <-acked:
+		return
+	case <-time.After(n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+
+	for _, m := range n.randomMembers(n.cfg.IndirectChecks, target.Name) {
+		n.send(m.Addr, &message{Type: pingReqMsg, Seq: seq, Target: target.Addr, Members: n.piggyback()})
+	}
+	select {
+	case <-acked:
+		return
+	case <-time.After(n.cfg.ProbeInterval - n.cfg.ProbeTimeout):
+	case <-n.done:
+		return
+	}
+	target.State = Suspect
+	n.apply(target)
+}
+
+// nextTarget returns the next member to probe, in a random order renewed
+// once every member was probed
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for tries := 0; tries < 2; tries++ {
+		for n.probeIdx < len(n.probeOrder) {
+			m, ok := n.members[n.probeOrder[n.probeIdx]]
+			n.probeIdx++
+			if ok && m.State.member() {
+				return m.Member, true
+			}
+		}
+		n.probeOrder = n.probeOrder[:0]
+		for name, m := range n.members {
+			if name != n.cfg.Name && m.State.member() {
+				n.probeOrder = append(n.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(n.probeOrder), func(i, j int) {
+			n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+		})
+		n.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+// randomMembers returns up to k random alive members other than this
+// node and except
+func (n *Node) randomMembers(k int, except string) []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var members []Member
+	for name, m := range n.members {
+		if name != n.cfg.Name && name != except && m.State == Alive {
+			members = append(members, m.Member)
+		}
+	}
+	rand.Shuffle(len(members), func(i, j int) { members[i], members[j] = members[j], members[i] })
+	if len(members) > k {
+		members = members[:k]
+	}
+	return members
+}
+
+// reapSuspects declares dead the suspects past the suspicion timeout, and
+// forgets the members down for the reclaim timeout
+func (n *Node) reapSuspects() {
+	n.mu.Lock()
+	var dead []Member
+	for name, m := range n.members {
+		if !m.State.member() && name != n.cfg.Name && time.Since(m.down) >= n.cfg.ReclaimTimeout {
+			delete(n.members, name)
+			continue
+		}
+		if m.State == Suspect && time.Since(m.suspected) >= n.cfg.SuspicionTimeout {
+			u := m.Member
+			u.State = Dead
+			dead = append(dead, u)
+		}
+	}
+	n.mu.Unlock()
+	for _, u := range dead {
+		n.apply(u)
+	}
+}
+
+// expectAck returns a new sequence number, and a channel closed on its ack
+func (n *Node) expectAck() (uint64, <-chan struct{}) {
+	acked := make(chan struct{})
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.seq++
+	n.acks[n.seq] = func() { close(acked) }
+	return n.seq, acked
+}
+
+func (n *Node) forgetAck(seq uint64) {
+	n.mu.Lock()
+	delete(n.acks, seq)
+	n.mu.Unlock()
+}
+
+func (n *Node) send(addr string, msg *message) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.WriteToUDP(b, raddr)
+	return err
+}
+
+// notify schedules a call of OnChange. n.mu must be held, or n not
+// started yet.
+func (n *Node) notify() {
+	select {
+	case n.changed <- struct{}{}:
+	default:
+	}
+}
+
+// notifyLoop calls OnChange, with the latest members if they changed
+// several times meanwhile
+func (n *Node) notifyLoop() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.changed:
+			if n.cfg.OnChange == nil {
+				continue
+			}
+			members := n.Members()
+			names := make([]string, len(members))
+			for i, m := range members {
+				names[i] = m.Name
+			}
+			n.cfg.OnChange(names...)
+		case <-n.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package gossip
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode starts a node on loopback with short timeouts, it records the
+// names given to OnChange
+type testNode struct {
+	*Node
+	mu    sync.Mutex
+	names []string
+}
+
+func startNode(t *testing.T, name string) *testNode {
+	tn := &testNode{}
+	n, err := New(&Config{
+		Name:             name,
+		BindAddr:         "127.0.0.1:0",
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     10 * time.Millisecond,
+		SuspicionTimeout: 100 * time.Millisecond,
+		OnChange: func(names ...string) {
+			tn.mu.Lock()
+			tn.names = names
+			tn.mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.Node = n
+	return tn
+}
+
+func (tn *testNode) lastNames() []string {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	return tn.names
+}
+
+// waitNames waits for the last names given to OnChange of every node to
+// be expect
+func waitNames(t *testing.T, nodes []*testNode, expect ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, n := range nodes {
+		for !reflect.DeepEqual(n.lastNames(), expect) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: expect members %v, but got %v", n.cfg.Name, expect, n.lastNames())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestMembership(t *testing.T) {
+	var nodes []*testNode
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("node%d", i)
+		n := startNode(t, name)
+		defer n.Close()
+		nodes = append(nodes, n)
+		names = append(names, name)
+	}
+	waitNames(t, nodes[:1], "node0")
+
+	// joining one node is enough to learn about all of them
+	for _, n := range nodes[1:] {
+		if _, err := n.Join(nodes[0].Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitNames(t, nodes, names...)
+
+	// a failed node is suspected, then removed
+	nodes[3].Close()
+	waitNames(t, nodes[:3], names[:3]...)
+
+	// a node leaving is removed
+	if err := nodes[2].Leave(); err != nil {
+		t.Fatal(err)
+	}
+	waitNames(t, nodes[:2], names[:2]...)
+
+	// a node coming back refutes its death with a newer incarnation
+	back := startNode(t, "node3")
+	defer back.Close()
+	if _, err := back.Join(nodes[1].Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitNames(t, []*testNode{nodes[0], nodes[1], back}, "node0", "node1", "node3")
+}
+
+func TestRefute(t *testing.T) {
+	n := startNode(t, "node0")
+	defer n.Close()
+	n.apply(Member{Name: "node0", Addr: n.Addr(), State: Suspect, Incarnation: 3})
+	self := n.Members()[0]
+	if self.State != Alive || self.Incarnation != 4 {
+		t.Fatalf("expect alive at incarnation 4, but got %v at %d", self.State, self.Incarnation)
+	}
+	if updates := n.piggyback(); len(updates) != 1 || updates[0] != self {
+		t.Fatalf("expect the refutation to be gossiped, but got %v", updates)
+	}
+}
+
+func TestApply(t *testing.T) {
+	n := startNode(t, "node0")
+	defer n.Close()
+	tests := []struct {
+		update Member
+		expect State
+		inc    uint64
+	}{
+		{Member{Name: "a", State: Alive, Incarnation: 1}, Alive, 1},
+		{Member{Name: "a", State: Suspect, Incarnation: 0}, Alive, 1}, // stale
+		{Member{Name: "a", State: Suspect, Incarnation: 1}, Suspect, 1},
+		{Member{Name: "a", State: Alive, Incarnation: 1}, Suspect, 1}, // needs a newer incarnation
+		{Member{Name: "a", State: Alive, Incarnation: 2}, Alive, 2},
+		{Member{Name: "a", State: Dead, Incarnation: 2}, Dead, 2},
+		{Member{Name: "a", State: Suspect, Incarnation: 2}, Dead, 2},
+		{Member{Name: "a", State: Alive, Incarnation: 3}, Alive, 3},
+	}
+	for i, tt := range tests {
+		n.apply(tt.update)
+		n.mu.Lock()
+		m := n.members["a"].Member
+		n.mu.Unlock()
+		if m.State != tt.expect || m.Incarnation != tt.inc {
+			t.Fatalf("%d: expect %v at %d, but got %v at %d", i, tt.expect, tt.inc, m.State, m.Incarnation)
+		}
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	n := startNode(t, "node0")
+	defer n.Close()
+	n.apply(Member{Name: "a", State: Alive, Incarnation: 1})
+	n.apply(Member{Name: "a", State: Dead, Incarnation: 1})
+	n.apply(Member{Name: "b", State: Left, Incarnation: 1})
+	n.mu.Lock()
+	n.members["a"].down = time.Now().Add(-n.cfg.ReclaimTimeout)
+	n.mu.Unlock()
+	n.reapSuspects()
+	n.mu.Lock()
+	_, a := n.members["a"]
+	_, b := n.members["b"]
+	n.mu.Unlock()
+	if a || !b {
+		t.Fatalf("expect only a to be forgotten, but got a %v b %v", a, b)
+	}
+}
+
+func TestAdvertiseAddr(t *testing.T) {
+	if _, err := New(&Config{Name: "node0", BindAddr: "0.0.0.0:0"}); err == nil {
+		t.Fatal("expect an unspecified bind address to need AdvertiseAddr")
+	}
+	n, err := New(&Config{Name: "node0", BindAddr: "0.0.0.0:0", AdvertiseAddr: "10.0.0.1:7946"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+	if n.Addr() != "10.0.0.1:7946" {
+		t.Fatalf("expect the advertised address, but got %s", n.Addr())
+	}
+}
+
+func TestCloseConcurrent(t *testing.T) {
+	n := startNode(t, "node0")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.Close()
+		}()
+	}
+	wg.Wait()
+	select {
+	case <-n.done:
+	default:
+		t.Fatal("expect the node to be closed")
+	}
+}
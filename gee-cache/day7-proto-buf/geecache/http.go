@@ -1,15 +1,20 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
@@ -17,39 +22,120 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	// defaultTimeout limits the time of a request to a peer, so that a
+	// stalled peer fails the load instead of blocking it
+	defaultTimeout = 10 * time.Second
+	// maxBodyLen limits the bodies of the values set by the peers
+	maxBodyLen = 16 << 20
 )
 
-// HTTPPool implements PeerPicker for a pool of HTTP peers.
+// defaultTransport is the RoundTripper of the peer requests unless
+// HTTPPoolOptions.Transport is set. It keeps more idle connections per
+// host than http.DefaultTransport, since the peers are few and busy.
+var defaultTransport http.RoundTripper = newDefaultTransport()
+
+// newDefaultTransport clones http.DefaultTransport, or builds a transport of
+// the same settings if it was replaced
+func newDefaultTransport() *http.Transport {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if ok {
+		t = t.Clone()
+	} else {
+		t = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		}
+	}
+	t.MaxIdleConnsPerHost = 64
+	return t
+}
+
+// HTTPPool implements PeerPicker for a pool of HTTP peers. The requests
+// of the peers aren't authenticated, anyone who can reach the base path can
+// set or remove entries: serve it on a private network only.
 type HTTPPool struct {
 	// this peer's base URL, e.g. "https://example.net:8000"
 	self        string
-	basePath    string
+	opts        HTTPPoolOptions
+	client      *http.Client
 	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
+	peers       consistenthash.Picker
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
 }
 
+// HTTPPoolOptions are the configurations of a HTTPPool.
+type HTTPPoolOptions struct {
+	// BasePath specifies the HTTP path that will serve geecache requests.
+	// If blank, it defaults to "/_geecache/".
+	BasePath string
+	// Replicas specifies the number of virtual nodes of each peer on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+	// NewPicker creates the consistent hash picking the peer of a key,
+	// e.g. a consistenthash.Maglev. If nil, a consistenthash.Map of
+	// Replicas and HashFn is used.
+	NewPicker func() consistenthash.Picker
+	// Transport makes the requests to the peers. If nil, a transport
+	// shared by the pools and keeping connections alive is used.
+	Transport http.RoundTripper
+	// Timeout limits the time of a request to a peer.
+	// If blank, it defaults to 10s.
+	Timeout time.Duration
+}
+
 // NewHTTPPool initializes an HTTP pool of peers.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts initializes an HTTP pool of peers with the given options,
+// a nil o is the default options.
+func NewHTTPPoolOpts(self string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{self: self}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath == "" {
+		p.opts.BasePath = defaultBasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
 	}
+	if p.opts.Transport == nil {
+		p.opts.Transport = defaultTransport
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultTimeout
+	}
+	p.client = &http.Client{Transport: p.opts.Transport, Timeout: p.opts.Timeout}
+	return p
 }
 
 // Log info with server name
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	logf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
 // ServeHTTP handle all http requests
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+	if !strings.HasPrefix(r.URL.Path, p.opts.BasePath) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == p.opts.BasePath+"stats" {
+		p.serveStats(w)
+		return
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 	// /<basepath>/<groupname>/<key> required
-	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
+	parts := strings.SplitN(r.URL.Path[len(p.opts.BasePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
@@ -64,14 +150,35 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	group.Stats.ServerRequests.Add(1)
+	res := &pb.Response{}
+	switch r.Method {
+	case http.MethodPut:
+		// the body is a pb.Request of the value and its ttl
+		b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyLen))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := &pb.Request{}
+		if err = proto.Unmarshal(b, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setFromPeer(r.Context(), key, req.Value, time.Duration(req.Ttl))
+	case http.MethodDelete:
+		group.removeLocally(key)
+	default:
+		view, err := group.getForPeer(r.Context(), key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Value = view.ByteSlice()
 	}
 
 	// Write the value to the response body as a proto message.
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -81,15 +188,51 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// groupStats is the JSON of the statistics of a group
+type groupStats struct {
+	Stats     *Stats
+	MainCache CacheStats
+	HotCache  CacheStats
+}
+
+// serveStats writes the statistics of all groups as JSON, keyed by name
+func (p *HTTPPool) serveStats(w http.ResponseWriter) {
+	all := make(map[string]groupStats)
+	for _, g := range allGroups() {
+		all[g.name] = groupStats{
+			Stats:     &g.Stats,
+			MainCache: g.CacheStats(MainCache),
+			HotCache:  g.CacheStats(HotCache),
+		}
+	}
+	body, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
 // Set updates the pool's list of peers.
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
+	if p.opts.NewPicker != nil {
+		p.peers = p.opts.NewPicker()
+	} else {
+		p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	}
 	p.peers.Add(peers...)
+	// keep the getters of the peers staying, with their circuit breakers
+	old := p.httpGetters
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		if g, ok := old[peer]; ok {
+			p.httpGetters[peer] = g
+			continue
+		}
+		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.opts.BasePath, client: p.client}
 	}
 }
 
@@ -98,41 +241,92 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// PickPeers picks the n holders of key, see PeerPicker
+func (p *HTTPPool) PickPeers(key string, n int) ([]PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	pos := -1
+	for i, peer := range p.peers.GetN(key, n) {
+		if peer == p.self {
+			pos = i
+			continue
+		}
+		peers = append(peers, p.httpGetters[peer])
+	}
+	return peers, pos
+}
+
+// Peers returns the getters of all the peers except this one
+func (p *HTTPPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
 
 type httpGetter struct {
 	baseURL string
+	client  *http.Client
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.do(ctx, http.MethodGet, in, nil, out)
+}
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	body, err := proto.Marshal(&pb.Request{Value: in.GetValue(), Ttl: in.GetTtl()})
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
+	}
+	return h.do(ctx, http.MethodPut, in, body, out)
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.do(ctx, http.MethodDelete, in, nil, out)
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
+func (h *httpGetter) do(ctx context.Context, method string, in *pb.Request, body []byte, out *pb.Response) error {
 	u := fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
-	res, err := http.Get(u)
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res, err := h.client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		// drain the body so that the connection can be reused
+		io.Copy(ioutil.Discard, res.Body)
+		return &peerError{res.Status}
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	b, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
 
-	if err = proto.Unmarshal(bytes, out); err != nil {
+	if err = proto.Unmarshal(b, out); err != nil {
 		return fmt.Errorf("decoding response body: %v", err)
 	}
 
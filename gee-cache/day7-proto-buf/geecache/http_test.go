@@ -0,0 +1,274 @@
+package geecache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPPoolStats(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("http-stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest("GET", "/_geecache/http-stats/Tom", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expect 200, but got %d", w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest("GET", "/_geecache/stats", nil))
+	var all map[string]struct {
+		Stats     map[string]int64
+		MainCache CacheStats
+		HotCache  CacheStats
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	st, ok := all[gee.name]
+	if !ok {
+		t.Fatalf("expect stats of %s, but got %s", gee.name, w.Body.String())
+	}
+	if st.Stats["ServerRequests"] != 2 || st.Stats["CacheHits"] != 1 || st.Stats["Loads"] != 1 || st.Stats["LocalLoads"] != 1 ||
+		st.MainCache.Items != 1 || st.MainCache.Bytes != 6 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func TestHTTPPoolTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set(srv.URL)
+	getter := pool.httpGetters[srv.URL]
+	if getter.client.Timeout != defaultTimeout {
+		t.Fatalf("expect peer requests limited to %v, but got %v", defaultTimeout, getter.client.Timeout)
+	}
+	getter.client.Timeout = 20 * time.Millisecond
+	done := make(chan error, 1)
+	go func() {
+		done <- getter.Get(dummyCtx, &pb.Request{Group: "scores", Key: "Tom"}, &pb.Response{})
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expect a stalled peer to fail the request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect a request to a stalled peer to time out")
+	}
+}
+
+func TestHTTPPoolSetRemove(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	loads := 0
+	gee := NewGroup("http-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db"), nil
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	pool.Set(srv.URL)
+	peer := pool.httpGetters[srv.URL]
+
+	req := &pb.Request{Group: gee.name, Key: "Tom", Value: []byte("630")}
+	if err := peer.Set(dummyCtx, req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	res := &pb.Response{}
+	if err := peer.Get(dummyCtx, req, res); err != nil || string(res.Value) != "630" || loads != 0 {
+		t.Fatalf("expect the value set, but got %s %v", res.Value, err)
+	}
+	if err := peer.Remove(dummyCtx, req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Get(dummyCtx, req, res); err != nil || string(res.Value) != "db" || loads != 1 {
+		t.Fatalf("expect the value to be loaded after Remove, but got %s %v", res.Value, err)
+	}
+	req.Value = make([]byte, maxBodyLen)
+	if err := peer.Set(dummyCtx, req, &pb.Response{}); err == nil {
+		t.Fatal("expect a body over maxBodyLen to be rejected")
+	}
+}
+
+type countingTransport struct {
+	requests int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+	return defaultTransport.RoundTrip(req)
+}
+
+func TestDefaultTransportReplaced(t *testing.T) {
+	saved := http.DefaultTransport
+	defer func() { http.DefaultTransport = saved }()
+	http.DefaultTransport = &countingTransport{}
+	if tr := newDefaultTransport(); tr.MaxIdleConnsPerHost != 64 || tr.DialContext == nil {
+		t.Fatalf("expect a transport to be built, but got %+v", tr)
+	}
+}
+
+func TestHTTPPoolOptions(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("http-opts", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if key == "slow" {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return []byte(key), nil
+		}))
+
+	var conns int64
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	pool := NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{
+		BasePath:  "/cache/",
+		Transport: transport,
+		Timeout:   50 * time.Millisecond,
+	})
+	srv.Config.Handler = pool
+	pool.Set("http://other", srv.URL)
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest("GET", "/_geecache/http-opts/Tom", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 out of the base path, but got %d", w.Code)
+	}
+
+	peer := pool.httpGetters[srv.URL]
+	for i := 0; i < 3; i++ {
+		res := &pb.Response{}
+		if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "Tom"}, res); err != nil || string(res.Value) != "Tom" {
+			t.Fatalf("expect Tom, but got %s %v", res.Value, err)
+		}
+	}
+	if err := peer.Get(dummyCtx, &pb.Request{Group: "unknown", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("expect an error for an unknown group")
+	}
+	if n := atomic.LoadInt64(&transport.requests); n != 4 {
+		t.Fatalf("expect 4 requests through the transport, but got %d", n)
+	}
+	if n := atomic.LoadInt64(&conns); n != 1 {
+		t.Fatalf("expect the connection to be reused, but got %d connections", n)
+	}
+
+	start := time.Now()
+	if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "slow"}, &pb.Response{}); err == nil {
+		t.Fatal("expect the request to time out")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expect the request to time out after 50ms, but took %v", d)
+	}
+}
+
+func TestHTTPPoolPicker(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	pool := NewHTTPPoolOpts("http://10.0.0.1:8001", &HTTPPoolOptions{
+		NewPicker: func() consistenthash.Picker { return consistenthash.NewMaglev(0, nil) },
+	})
+	pool.Set("http://10.0.0.1:8001", "http://10.0.0.2:8001")
+	if _, ok := pool.peers.(*consistenthash.Maglev); !ok {
+		t.Fatalf("expect a Maglev, but got %T", pool.peers)
+	}
+	remote := 0
+	for i := 0; i < 100; i++ {
+		if peer, ok := pool.PickPeer(fmt.Sprint("key", i)); ok {
+			if peer != pool.httpGetters["http://10.0.0.2:8001"] {
+				t.Fatalf("expect the other peer, but got %v", peer)
+			}
+			remote++
+		}
+	}
+	if remote < 30 || remote > 70 {
+		t.Fatalf("expect about half of the keys on the other peer, but got %d", remote)
+	}
+
+	// the getters of the peers staying are kept
+	other := pool.httpGetters["http://10.0.0.2:8001"]
+	pool.Set("http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001")
+	if pool.httpGetters["http://10.0.0.2:8001"] != other {
+		t.Fatal("expect the getter of a peer staying to be kept")
+	}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint("key", i)
+		holders := pool.peers.GetN(key, 2)
+		peers, pos := pool.PickPeers(key, 2)
+		switch {
+		case holders[0] == pool.self:
+			if pos != 0 || len(peers) != 1 || peers[0] != pool.httpGetters[holders[1]] {
+				t.Fatalf("expect this peer to own %s, but got %v at %d", key, peers, pos)
+			}
+		case holders[1] == pool.self:
+			if pos != 1 || len(peers) != 1 || peers[0] != pool.httpGetters[holders[0]] {
+				t.Fatalf("expect this peer to hold %s, but got %v at %d", key, peers, pos)
+			}
+		default:
+			if pos != -1 || len(peers) != 2 || peers[0] != pool.httpGetters[holders[0]] {
+				t.Fatalf("expect 2 other holders of %s, but got %v at %d", key, peers, pos)
+			}
+		}
+	}
+}
+
+// TestHTTPPoolDisagree has the peers disagree on the owner of the keys:
+// the pool of this peer picks the other one, whose requests come back to
+// this peer as if it picked this one
+func TestHTTPPoolDisagree(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("http-disagree", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db:" + key), nil
+		}))
+	pool := NewHTTPPool("http://localhost:8001")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+	pool.Set(srv.URL)
+	gee.RegisterPeers(pool)
+
+	ctx, cancel := context.WithTimeout(dummyCtx, 2*time.Second)
+	defer cancel()
+	if view, err := gee.Get(ctx, "Tom"); err != nil || view.String() != "db:Tom" {
+		t.Fatalf("expect the other peer to load db:Tom itself, but got %s %v", view, err)
+	}
+	if st := &gee.Stats; st.PeerLoads.Get() != 1 || st.LocalLoads.Get() != 1 || st.ServerRequests.Get() != 1 {
+		t.Fatalf("expect a single request served from the getter, but got %+v", st)
+	}
+}
@@ -1,6 +1,10 @@
 package lru
 
-import "container/list"
+import (
+	"container/heap"
+	"container/list"
+	"time"
+)
 
 // Cache is a LRU cache. It is not safe for concurrent access.
 type Cache struct {
@@ -8,13 +12,43 @@ type Cache struct {
 	nbytes   int64
 	ll       *list.List
 	cache    map[string]*list.Element
+	// entries with an expiry, the earliest first
+	expiries expiryHeap
 	// optional and executed when an entry is purged.
-	OnEvicted func(key string, value Value)
+	OnEvicted func(key string, value Value, reason EvictReason)
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+// EvictReason tells why an entry is purged
+type EvictReason int
+
+const (
+	// Evicted entries are purged to stay within maxBytes
+	Evicted EvictReason = iota
+	// Expired entries are purged after their expiry
+	Expired
+	// Removed entries are purged by Remove
+	Removed
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Evicted:
+		return "evicted"
+	case Expired:
+		return "expired"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
 }
 
 type entry struct {
-	key   string
-	value Value
+	key    string
+	value  Value
+	expire time.Time // zero if the entry never expires
+	index  int       // index in expiries, -1 if not in it
 }
 
 // Value use Len to count how many bytes it takes
@@ -23,7 +57,7 @@ type Value interface {
 }
 
 // New is the Constructor of Cache
-func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+func New(maxBytes int64, onEvicted func(string, Value, EvictReason)) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes,
 		ll:        list.New(),
@@ -32,48 +66,154 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	}
 }
 
-// Add adds a value to the cache.
-func (c *Cache) Add(key string, value Value) {
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// Add adds a value to the cache, it expires at expire unless expire is zero.
+func (c *Cache) Add(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		c.setExpire(kv, expire)
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		kv := &entry{key: key, value: value, index: -1}
+		c.setExpire(kv, expire)
+		ele := c.ll.PushFront(kv)
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
+	c.fit()
+}
+
+// Resize sets the budget to maxBytes, 0 for no limit, and removes the
+// oldest items until the cache fits
+func (c *Cache) Resize(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.fit()
+}
+
+func (c *Cache) fit() {
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
 		c.RemoveOldest()
 	}
 }
 
-// Get look ups a key's value
+func (c *Cache) setExpire(kv *entry, expire time.Time) {
+	kv.expire = expire
+	switch {
+	case kv.index >= 0 && expire.IsZero():
+		heap.Remove(&c.expiries, kv.index)
+	case kv.index >= 0:
+		heap.Fix(&c.expiries, kv.index)
+	case !expire.IsZero():
+		heap.Push(&c.expiries, kv)
+	}
+}
+
+// Get look ups a key's value, expired entries are removed and missed
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		if !kv.expire.IsZero() && !c.now().Before(kv.expire) {
+			c.removeElement(ele, Expired)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
 }
 
+// Peek look ups a key's value without updating its recency, expired
+// entries are missed but not removed
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expire.IsZero() || c.now().Before(kv.expire) {
+			return kv.value, true
+		}
+	}
+	return
+}
+
 // RemoveOldest removes the oldest item
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
-		}
+		c.removeElement(ele, Evicted)
+	}
+}
+
+// Remove removes the provided key from the cache
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, Removed)
+	}
+}
+
+// RemoveExpired removes the expired items, and returns how many were removed
+func (c *Cache) RemoveExpired() int {
+	n := 0
+	now := c.now()
+	for len(c.expiries) > 0 && !now.Before(c.expiries[0].expire) {
+		c.removeElement(c.cache[c.expiries[0].key], Expired)
+		n++
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	if kv.index >= 0 {
+		heap.Remove(&c.expiries, kv.index)
+	}
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
+// Bytes the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 // Len the number of cache entries
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// expiryHeap is a min-heap of entries ordered by expiry
+type expiryHeap []*entry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	kv := x.(*entry)
+	kv.index = len(*h)
+	*h = append(*h, kv)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	kv := old[len(old)-1]
+	old[len(old)-1] = nil
+	kv.index = -1
+	*h = old[:len(old)-1]
+	return kv
+}
@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -13,7 +14,7 @@ func (d String) Len() int {
 
 func TestGet(t *testing.T) {
 	lru := New(int64(0), nil)
-	lru.Add("key1", String("1234"))
+	lru.Add("key1", String("1234"), time.Time{})
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
@@ -27,9 +28,9 @@ func TestRemoveoldest(t *testing.T) {
 	v1, v2, v3 := "value1", "value2", "v3"
 	cap := len(k1 + k2 + v1 + v2)
 	lru := New(int64(cap), nil)
-	lru.Add(k1, String(v1))
-	lru.Add(k2, String(v2))
-	lru.Add(k3, String(v3))
+	lru.Add(k1, String(v1), time.Time{})
+	lru.Add(k2, String(v2), time.Time{})
+	lru.Add(k3, String(v3), time.Time{})
 
 	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
 		t.Fatalf("Removeoldest key1 failed")
@@ -38,14 +39,14 @@ func TestRemoveoldest(t *testing.T) {
 
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		keys = append(keys, key)
 	}
 	lru := New(int64(10), callback)
-	lru.Add("key1", String("123456"))
-	lru.Add("k2", String("k2"))
-	lru.Add("k3", String("k3"))
-	lru.Add("k4", String("k4"))
+	lru.Add("key1", String("123456"), time.Time{})
+	lru.Add("k2", String("k2"), time.Time{})
+	lru.Add("k3", String("k3"), time.Time{})
+	lru.Add("k4", String("k4"), time.Time{})
 
 	expect := []string{"key1", "k2"}
 
@@ -56,10 +57,74 @@ func TestOnEvicted(t *testing.T) {
 
 func TestAdd(t *testing.T) {
 	lru := New(int64(0), nil)
-	lru.Add("key", String("1"))
-	lru.Add("key", String("111"))
+	lru.Add("key", String("1"), time.Time{})
+	lru.Add("key", String("111"), time.Time{})
 
 	if lru.nbytes != int64(len("key")+len("111")) {
 		t.Fatal("expected 6 but got", lru.nbytes)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+	reasons := make(map[string]EvictReason)
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		reasons[key] = reason
+	})
+	lru.Now = func() time.Time { return now }
+	lru.Add("k1", String("1"), now.Add(time.Second))
+	lru.Add("k2", String("2"), now.Add(3*time.Second))
+	lru.Add("k3", String("3"), time.Time{})
+
+	if _, ok := lru.Get("k1"); !ok {
+		t.Fatalf("k1 should not expire yet")
+	}
+	now = now.Add(time.Second)
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 2 || reasons["k1"] != Expired {
+		t.Fatalf("k1 should be expired and removed on get")
+	}
+
+	// setting the expiry again replaces it
+	lru.Add("k2", String("2"), now.Add(time.Second))
+	now = now.Add(time.Second)
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 || reasons["k2"] != Expired {
+		t.Fatalf("k2 should be removed by RemoveExpired, %d removed", n)
+	}
+	now = now.Add(time.Hour)
+	if _, ok := lru.Get("k3"); !ok || lru.nbytes != int64(len("k3")+len("3")) {
+		t.Fatalf("k3 should never expire")
+	}
+}
+
+func TestEvictReason(t *testing.T) {
+	var reason EvictReason = -1
+	lru := New(int64(4), func(key string, value Value, r EvictReason) {
+		reason = r
+	})
+	lru.Add("k1", String("1"), time.Now().Add(time.Hour))
+	lru.Add("k2", String("2"), time.Time{})
+	if reason != Evicted || len(lru.expiries) != 0 {
+		t.Fatalf("k1 should be evicted, got reason %v", reason)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	now := time.Now()
+	lru := New(int64(len("k1k2")+2), nil)
+	lru.Now = func() time.Time { return now }
+	lru.Add("k1", String("1"), now.Add(time.Second))
+	lru.Add("k2", String("2"), time.Time{})
+	if v, ok := lru.Peek("k1"); !ok || v.(String) != "1" {
+		t.Fatalf("cache hit k1=1 failed")
+	}
+	// k1 is still the oldest
+	lru.Add("k3", String("3"), time.Time{})
+	if _, ok := lru.Peek("k1"); ok {
+		t.Fatalf("Peek should not update the recency of k1")
+	}
+	now = now.Add(time.Second)
+	lru.Add("k4", String("4"), now)
+	if _, ok := lru.Peek("k4"); ok || lru.Len() != 2 {
+		t.Fatalf("Peek should miss expired k4 without removing it")
+	}
+}
@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	"geecache/policy"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// An Option configures a Group
+type Option func(*Group)
+
+// WithTTL sets the default time to live of the values loaded by the group.
+// Each value lives ttl plus a random duration up to jitter, so that values
+// loaded together don't expire together.
+func WithTTL(ttl time.Duration, jitter time.Duration) Option {
+	return func(g *Group) {
+		g.ttl = ttl
+		g.jitter = jitter
+	}
+}
+
+// WithSweepInterval sets how often expired values are removed in the
+// background, a minute by default. Expired values are also removed when
+// they're looked up. Zero or less disables the sweeper.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(g *Group) {
+		g.sweepInterval = interval
+	}
+}
+
+// WithPolicy sets the eviction policy of the cache, e.g. policy.NewTinyLFU.
+// It's LRU by default.
+func WithPolicy(newPolicy policy.Factory) Option {
+	return func(g *Group) {
+		g.newPolicy = newPolicy
+	}
+}
+
+// WithShards splits the cache into n shards, rounded up to a power of two,
+// each holding a share of cacheBytes. A value larger than the share of a
+// shard isn't cached. By default there are 16 shards, fewer for caches
+// under 16MB so that shards hold at least 1MB.
+func WithShards(n int) Option {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithHotCache sets the share of cacheBytes given to the hot cache once
+// peers are registered, and the fraction of the values fetched from peers
+// stored in it. The hot cache gets 1/8 of the bytes and 1/10 of the values
+// by default, a zero fraction or sample disables it. fraction is at most
+// 1/2, so that the main cache keeps half of the bytes, and sample is at
+// most 1.
+func WithHotCache(fraction float64, sample float64) Option {
+	fraction = math.Max(0, math.Min(fraction, maxHotFraction))
+	sample = math.Max(0, math.Min(sample, 1))
+	return func(g *Group) {
+		g.hotFraction = fraction
+		g.hotSample = sample
+	}
+}
+
+const maxHotFraction = 0.5
+
+// WithHolders makes n peers hold a copy of each key: its owner, which
+// copies the values it loads to the others, and the next n-1 peers on the
+// ring. Gets try the owner, then the other holders, before loading the
+// value. There is a single holder by default, and n is at least 1. Not to
+// be confused with the Replicas of the pools, the virtual nodes of a peer.
+func WithHolders(n int) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(g *Group) {
+		g.numHolders = n
+	}
+}
+
+// WithBreaker sets the circuit breakers of the peers: failureThreshold
+// consecutive failures to reach a peer mark it down for openTimeout. Gets
+// skip a peer down for the next holder of the key or load the value
+// themselves, Sets and Removes to it fail. Then a single call probes the
+// peer. Defaults are 5 and 30s, a zero threshold disables them.
+func WithBreaker(failureThreshold int, openTimeout time.Duration) Option {
+	return func(g *Group) {
+		g.failureThreshold = failureThreshold
+		g.openTimeout = openTimeout
+	}
+}
+
+// WithClock replaces time.Now, e.g. to control expiry in tests
+func WithClock(now func() time.Time) Option {
+	return func(g *Group) {
+		g.now = now
+	}
+}
+
+// expire returns the expiry of a value loaded now, zero if it never expires
+func (g *Group) expire() time.Time {
+	if g.ttl <= 0 {
+		return time.Time{}
+	}
+	ttl := g.ttl
+	if g.jitter > 0 {
+		ttl += time.Duration(rand.Int63n(int64(g.jitter)))
+	}
+	return g.now().Add(ttl)
+}
+
+func (g *Group) sweep() {
+	ticker := time.NewTicker(g.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.mainCache.removeExpired()
+			g.hotCache.removeExpired()
+		}
+	}
+}
@@ -1,14 +1,39 @@
 package geecache
 
-import pb "geecache/geecachepb"
+import (
+	"context"
+	pb "geecache/geecachepb"
+)
 
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// PickPeers returns the peers holding key other than this one, up to
+	// n holders in all: its owner first, then the peers taking over from
+	// the owner if it goes away. pos is the position of this peer among
+	// the holders, -1 if it isn't one.
+	PickPeers(key string, n int) (peers []PeerGetter, pos int)
+	// Peers returns all the peers except this one
+	Peers() []PeerGetter
 }
 
-// PeerGetter is the interface that must be implemented by a peer.
+// PeerGetter is the interface that must be implemented by a peer. The
+// requests give up when ctx is done.
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Set stores in.Value on the peer, which must own in.Key
+	Set(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Remove removes in.Key from the caches of the peer
+	Remove(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// A peerError is an error returned by a peer that served the request, as
+// opposed to a failure to reach the peer, so it doesn't trip its breaker.
+type peerError struct {
+	msg string
+}
+
+func (e *peerError) Error() string {
+	return "server returned: " + e.msg
 }
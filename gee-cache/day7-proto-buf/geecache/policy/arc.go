@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"geecache/lru"
+	"time"
+)
+
+// ARC is the Adaptive Replacement Cache of Megiddo and Modha, measured in
+// bytes. t1 holds entries seen once recently and t2 entries seen at least
+// twice, b1 and b2 remember the keys evicted from them. A hit in b1 grows
+// the target p of t1, a hit in b2 shrinks it, so that the cache adapts
+// between recency and frequency and a scan can't flush t2.
+type ARC struct {
+	core
+	t1, t2 segment
+	b1, b2 ghosts
+	p      int64 // target bytes of t1
+}
+
+// NewARC is the constructor of ARC
+func NewARC(c Config) Policy {
+	return &ARC{core: newCore(c)}
+}
+
+// Add adds a value to the cache
+func (c *ARC) Add(key string, value lru.Value, expire time.Time) {
+	if it, ok := c.items[key]; ok {
+		c.update(it, value, expire)
+		it.seg.remove(it)
+		c.t2.pushFront(it)
+		c.replace(false)
+		return
+	}
+
+	size := int64(len(key)) + int64(value.Len())
+	switch {
+	case c.b1.contains(key):
+		c.p = min64(c.p+max64(c.b2.bytes/max64(c.b1.bytes, 1), 1)*size, c.MaxBytes)
+		c.b1.remove(key)
+		c.t2.pushFront(c.insert(key, value, expire))
+		c.replace(false)
+	case c.b2.contains(key):
+		c.p = max64(c.p-max64(c.b1.bytes/max64(c.b2.bytes, 1), 1)*size, 0)
+		c.b2.remove(key)
+		c.t2.pushFront(c.insert(key, value, expire))
+		c.replace(true)
+	default:
+		c.t1.pushFront(c.insert(key, value, expire))
+		c.replace(false)
+	}
+	c.trimGhosts()
+}
+
+// Resize sets the budget and evicts entries until the cache fits, the
+// target of t1 is kept within the budget
+func (c *ARC) Resize(maxBytes int64) {
+	c.MaxBytes = maxBytes
+	if maxBytes != 0 {
+		c.p = min64(c.p, maxBytes)
+	}
+	c.replace(false)
+	c.trimGhosts()
+}
+
+// trimGhosts keeps t1 and b1 within the budget, and all four lists
+// within twice the budget
+func (c *ARC) trimGhosts() {
+	if c.MaxBytes != 0 {
+		c.b1.trim(max64(c.MaxBytes-c.t1.bytes, 0))
+		c.b2.trim(max64(2*c.MaxBytes-c.t1.bytes-c.t2.bytes-c.b1.bytes, 0))
+	}
+}
+
+// replace evicts entries until the cache fits, from t1 if it's over its
+// target p and from t2 otherwise. The evicted keys become ghosts.
+func (c *ARC) replace(inB2 bool) {
+	for c.full() {
+		var it *item
+		if c.t1.bytes > 0 && (c.t1.bytes > c.p || (inB2 && c.t1.bytes == c.p) || c.t2.bytes == 0) {
+			it = c.t1.back()
+			c.b1.add(it.key, it.size())
+		} else {
+			it = c.t2.back()
+			c.b2.add(it.key, it.size())
+		}
+		c.remove(it, lru.Evicted, unlinkSegment)
+	}
+}
+
+// Get looks up a key's value
+func (c *ARC) Get(key string) (lru.Value, bool) {
+	it, ok := c.lookup(key, unlinkSegment)
+	if !ok {
+		return nil, false
+	}
+	it.seg.remove(it)
+	c.t2.pushFront(it)
+	return it.value, true
+}
+
+// Remove removes the item of key
+func (c *ARC) Remove(key string) {
+	c.removeKey(key, unlinkSegment)
+}
+
+// RemoveExpired removes the expired items
+func (c *ARC) RemoveExpired() int {
+	return c.removeExpired(unlinkSegment)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
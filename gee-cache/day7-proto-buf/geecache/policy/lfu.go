@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"container/heap"
+	"geecache/lru"
+	"time"
+)
+
+// LFU evicts the least frequently used entry, the least recently used
+// one among entries of the same frequency
+type LFU struct {
+	core
+	freqs freqHeap
+	tick  uint64
+}
+
+// NewLFU is the constructor of LFU
+func NewLFU(c Config) Policy {
+	return &LFU{core: newCore(c)}
+}
+
+func (c *LFU) touch(it *item) {
+	c.tick++
+	it.freq++
+	it.tick = c.tick
+	heap.Fix(&c.freqs, it.hidx)
+}
+
+func (c *LFU) unlink(it *item) {
+	heap.Remove(&c.freqs, it.hidx)
+}
+
+// Add adds a value to the cache
+func (c *LFU) Add(key string, value lru.Value, expire time.Time) {
+	if it, ok := c.items[key]; ok {
+		c.update(it, value, expire)
+		c.touch(it)
+	} else {
+		it := c.insert(key, value, expire)
+		c.tick++
+		it.freq, it.tick = 1, c.tick
+		heap.Push(&c.freqs, it)
+	}
+	c.fit()
+}
+
+// Resize sets the budget and evicts entries until the cache fits
+func (c *LFU) Resize(maxBytes int64) {
+	c.MaxBytes = maxBytes
+	c.fit()
+}
+
+func (c *LFU) fit() {
+	for c.full() {
+		c.remove(c.freqs[0], lru.Evicted, c.unlink)
+	}
+}
+
+// Get looks up a key's value
+func (c *LFU) Get(key string) (lru.Value, bool) {
+	it, ok := c.lookup(key, c.unlink)
+	if !ok {
+		return nil, false
+	}
+	c.touch(it)
+	return it.value, true
+}
+
+// Remove removes the item of key
+func (c *LFU) Remove(key string) {
+	c.removeKey(key, c.unlink)
+}
+
+// RemoveExpired removes the expired items
+func (c *LFU) RemoveExpired() int {
+	return c.removeExpired(c.unlink)
+}
+
+// freqHeap is a min-heap of entries ordered by frequency, then recency
+type freqHeap []*item
+
+func (h freqHeap) Len() int { return len(h) }
+
+func (h freqHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h freqHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].hidx = i
+	h[j].hidx = j
+}
+
+func (h *freqHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.hidx = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *freqHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	it.hidx = -1
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,294 @@
+// Package policy implements eviction policies of a cache bounded in bytes:
+// LRU, LFU, ARC, 2Q and W-TinyLFU. None of them is safe for concurrent
+// access.
+package policy
+
+import (
+	"container/heap"
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Policy is a cache evicting entries to stay within its byte budget.
+// lru.Cache is a Policy.
+type Policy interface {
+	// Add adds a value, it expires at expire unless expire is zero
+	Add(key string, value lru.Value, expire time.Time)
+	// Get looks up a value, expired values are removed and missed
+	Get(key string) (lru.Value, bool)
+	// Peek looks up a value like Get without updating the policy, it
+	// doesn't modify the cache and is safe to call from many readers
+	Peek(key string) (lru.Value, bool)
+	// Remove removes the value of key, if any
+	Remove(key string)
+	// RemoveExpired removes the expired values and returns how many
+	RemoveExpired() int
+	// Len returns the number of entries
+	Len() int
+	// Bytes returns the size of the entries, keys included
+	Bytes() int64
+	// Resize sets the budget to maxBytes, 0 for no limit, evicting
+	// entries until the cache fits
+	Resize(maxBytes int64)
+}
+
+// Config configures a policy
+type Config struct {
+	// MaxBytes is the budget of keys and values, 0 for no limit
+	MaxBytes int64
+	// OnEvicted is optional and executed when an entry is purged
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+}
+
+// Factory creates a policy
+type Factory func(Config) Policy
+
+// NewLRU returns a lru.Cache, evicting the least recently used entry
+func NewLRU(c Config) Policy {
+	cache := lru.New(c.MaxBytes, c.OnEvicted)
+	cache.Now = c.Now
+	return cache
+}
+
+// item is an entry of a policy
+type item struct {
+	key    string
+	value  lru.Value
+	expire time.Time // zero if the entry never expires
+	index  int       // index in expiries, -1 if not in it
+
+	seg  *segment      // the segment holding the entry
+	elem *list.Element // element of the entry in seg
+	freq int           // for LFU
+	tick uint64        // for LFU, time of the last access
+	hidx int           // for LFU, index in the frequency heap
+}
+
+func (it *item) size() int64 {
+	return int64(len(it.key)) + int64(it.value.Len())
+}
+
+// core keeps the entries and their expiries, the policies order them
+type core struct {
+	Config
+	nbytes   int64
+	items    map[string]*item
+	expiries expiryHeap
+}
+
+func newCore(c Config) core {
+	return core{Config: c, items: make(map[string]*item)}
+}
+
+func (c *core) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// Len returns the number of entries
+func (c *core) Len() int {
+	return len(c.items)
+}
+
+// Peek looks up a value without updating the policy
+func (c *core) Peek(key string) (lru.Value, bool) {
+	it, ok := c.items[key]
+	if !ok || (!it.expire.IsZero() && !c.now().Before(it.expire)) {
+		return nil, false
+	}
+	return it.value, true
+}
+
+// Bytes returns the size of the entries
+func (c *core) Bytes() int64 {
+	return c.nbytes
+}
+
+// full reports whether the entries exceed the budget
+func (c *core) full() bool {
+	return c.MaxBytes != 0 && c.nbytes > c.MaxBytes
+}
+
+// lookup returns the entry of key, removing it with unlink if expired
+func (c *core) lookup(key string, unlink func(*item)) (*item, bool) {
+	it, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	if !it.expire.IsZero() && !c.now().Before(it.expire) {
+		c.remove(it, lru.Expired, unlink)
+		return nil, false
+	}
+	return it, true
+}
+
+// insert adds a new entry, the policy links it
+func (c *core) insert(key string, value lru.Value, expire time.Time) *item {
+	it := &item{key: key, value: value, index: -1, hidx: -1}
+	c.items[key] = it
+	c.nbytes += it.size()
+	c.setExpire(it, expire)
+	return it
+}
+
+// update replaces the value of an entry
+func (c *core) update(it *item, value lru.Value, expire time.Time) {
+	delta := int64(value.Len()) - int64(it.value.Len())
+	c.nbytes += delta
+	if it.seg != nil {
+		it.seg.bytes += delta
+	}
+	it.value = value
+	c.setExpire(it, expire)
+}
+
+func (c *core) setExpire(it *item, expire time.Time) {
+	it.expire = expire
+	switch {
+	case it.index >= 0 && expire.IsZero():
+		heap.Remove(&c.expiries, it.index)
+	case it.index >= 0:
+		heap.Fix(&c.expiries, it.index)
+	case !expire.IsZero():
+		heap.Push(&c.expiries, it)
+	}
+}
+
+// remove purges an entry after unlink removed it from the policy
+func (c *core) remove(it *item, reason lru.EvictReason, unlink func(*item)) {
+	unlink(it)
+	delete(c.items, it.key)
+	if it.index >= 0 {
+		heap.Remove(&c.expiries, it.index)
+	}
+	c.nbytes -= it.size()
+	if c.OnEvicted != nil {
+		c.OnEvicted(it.key, it.value, reason)
+	}
+}
+
+// removeKey removes the entry of key, if any
+func (c *core) removeKey(key string, unlink func(*item)) {
+	if it, ok := c.items[key]; ok {
+		c.remove(it, lru.Removed, unlink)
+	}
+}
+
+func (c *core) removeExpired(unlink func(*item)) int {
+	n := 0
+	now := c.now()
+	for len(c.expiries) > 0 && !now.Before(c.expiries[0].expire) {
+		c.remove(c.expiries[0], lru.Expired, unlink)
+		n++
+	}
+	return n
+}
+
+// segment is a LRU list of entries, the most recent at the front
+type segment struct {
+	ll    list.List
+	bytes int64
+}
+
+func (s *segment) pushFront(it *item) {
+	it.seg = s
+	it.elem = s.ll.PushFront(it)
+	s.bytes += it.size()
+}
+
+func (s *segment) moveToFront(it *item) {
+	s.ll.MoveToFront(it.elem)
+}
+
+func (s *segment) remove(it *item) {
+	s.ll.Remove(it.elem)
+	s.bytes -= it.size()
+	it.seg, it.elem = nil, nil
+}
+
+// back returns the least recent entry, nil if s is empty
+func (s *segment) back() *item {
+	if e := s.ll.Back(); e != nil {
+		return e.Value.(*item)
+	}
+	return nil
+}
+
+func unlinkSegment(it *item) {
+	if it.seg != nil {
+		it.seg.remove(it)
+	}
+}
+
+// ghosts remembers the keys and sizes of recently evicted entries
+type ghosts struct {
+	ll    list.List
+	keys  map[string]*list.Element
+	bytes int64
+}
+
+type ghost struct {
+	key  string
+	size int64
+}
+
+func (g *ghosts) contains(key string) bool {
+	_, ok := g.keys[key]
+	return ok
+}
+
+func (g *ghosts) add(key string, size int64) {
+	if g.keys == nil {
+		g.keys = make(map[string]*list.Element)
+	}
+	g.remove(key)
+	g.keys[key] = g.ll.PushFront(&ghost{key, size})
+	g.bytes += size
+}
+
+func (g *ghosts) remove(key string) {
+	if e, ok := g.keys[key]; ok {
+		g.ll.Remove(e)
+		delete(g.keys, key)
+		g.bytes -= e.Value.(*ghost).size
+	}
+}
+
+// trim forgets the oldest keys until g holds at most max bytes
+func (g *ghosts) trim(max int64) {
+	for g.bytes > max && g.ll.Len() > 0 {
+		g.remove(g.ll.Back().Value.(*ghost).key)
+	}
+}
+
+// expiryHeap is a min-heap of entries ordered by expiry
+type expiryHeap []*item
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expire.Before(h[j].expire) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	it.index = -1
+	*h = old[:len(old)-1]
+	return it
+}
@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"fmt"
+	"geecache/lru"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+var factories = []struct {
+	name string
+	new  Factory
+}{
+	{"LRU", NewLRU},
+	{"LFU", NewLFU},
+	{"ARC", NewARC},
+	{"2Q", NewTwoQueue},
+	{"W-TinyLFU", NewTinyLFU},
+}
+
+func TestGet(t *testing.T) {
+	for _, f := range factories {
+		p := f.new(Config{})
+		p.Add("key1", String("1234"), time.Time{})
+		p.Add("key1", String("12345"), time.Time{})
+		if v, ok := p.Get("key1"); !ok || string(v.(String)) != "12345" {
+			t.Fatalf("%s: cache hit key1=12345 failed", f.name)
+		}
+		if _, ok := p.Get("key2"); ok || p.Len() != 1 {
+			t.Fatalf("%s: cache miss key2 failed", f.name)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	for _, f := range factories {
+		var nbytes int64
+		p := f.new(Config{MaxBytes: 1000, OnEvicted: func(key string, value lru.Value, reason lru.EvictReason) {
+			if reason != lru.Evicted {
+				t.Fatalf("%s: expect %s to be evicted, but got %s", f.name, key, reason)
+			}
+			nbytes -= int64(len(key) + value.Len())
+		}})
+		for i, key := range zipfTrace(10000, 1000, 1.1, 1) {
+			if _, ok := p.Get(key); !ok {
+				value := String(fmt.Sprintf("%0*d", i%20, 0))
+				p.Add(key, value, time.Time{})
+				nbytes += int64(len(key) + value.Len())
+			}
+			if nbytes > 1000 || p.Bytes() != nbytes {
+				t.Fatalf("%s: %d bytes exceed the budget, or don't match %d", f.name, nbytes, p.Bytes())
+			}
+		}
+		if p.Len() == 0 {
+			t.Fatalf("%s: expect entries to be kept", f.name)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	for _, f := range factories {
+		now := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+		expired := 0
+		p := f.new(Config{
+			Now: func() time.Time { return now },
+			OnEvicted: func(key string, value lru.Value, reason lru.EvictReason) {
+				if reason == lru.Expired {
+					expired++
+				}
+			},
+		})
+		p.Add("k1", String("1"), now.Add(time.Second))
+		p.Add("k2", String("2"), now.Add(2*time.Second))
+		p.Add("k3", String("3"), time.Time{})
+		now = now.Add(time.Second)
+		if _, ok := p.Get("k1"); ok || p.Len() != 2 {
+			t.Fatalf("%s: k1 should be expired", f.name)
+		}
+		now = now.Add(time.Second)
+		if n := p.RemoveExpired(); n != 1 || p.Len() != 1 || expired != 2 {
+			t.Fatalf("%s: k2 should be removed by RemoveExpired", f.name)
+		}
+	}
+}
+
+func TestLFU(t *testing.T) {
+	p := NewLFU(Config{MaxBytes: 6})
+	p.Add("a", String("1"), time.Time{})
+	p.Add("b", String("1"), time.Time{})
+	p.Add("c", String("1"), time.Time{})
+	p.Get("a")
+	p.Get("a")
+	p.Get("c")
+	p.Add("d", String("1"), time.Time{})
+	if _, ok := p.Get("b"); ok {
+		t.Fatal("the least frequently used b should be evicted")
+	}
+	p.Add("e", String("1"), time.Time{})
+	if _, ok := p.Get("d"); ok {
+		t.Fatal("d, as frequent as c but less recent, should be evicted")
+	}
+}
+
+func TestResize(t *testing.T) {
+	for _, f := range factories {
+		p := f.new(Config{MaxBytes: 1000})
+		for i := 0; i < 100; i++ {
+			p.Add(fmt.Sprintf("k%02d", i), String("1234567"), time.Time{})
+		}
+		p.Resize(200)
+		if p.Bytes() > 200 || p.Len() == 0 {
+			t.Fatalf("%s: expect entries within the new budget, but got %d bytes of %d entries", f.name, p.Bytes(), p.Len())
+		}
+		for i := 0; i < 100; i++ {
+			p.Add(fmt.Sprintf("n%02d", i), String("1234567"), time.Time{})
+			if p.Bytes() > 200 {
+				t.Fatalf("%s: %d bytes exceed the new budget", f.name, p.Bytes())
+			}
+		}
+		p.Resize(0)
+		p.Add("big", String(make([]byte, 1000)), time.Time{})
+		if _, ok := p.Get("big"); !ok {
+			t.Fatalf("%s: expect no limit after Resize(0)", f.name)
+		}
+	}
+}
+
+// TestScanResistance checks a scan doesn't flush popular entries
+func TestScanResistance(t *testing.T) {
+	hot := scanTrace(10, "hot")
+	for _, f := range factories {
+		p := f.new(Config{MaxBytes: 20 * 6})
+		// hot entries are looked up again and again among other ones
+		for i := 0; i < 5; i++ {
+			simulate(p, hot, 1)
+			simulate(p, hot, 1)
+			simulate(p, scanTrace(10, fmt.Sprintf("w%d", i)), 1)
+		}
+		simulate(p, scanTrace(100, "scan"), 1)
+		kept := 0
+		for _, key := range hot {
+			if _, ok := p.Get(key); ok {
+				kept++
+			}
+		}
+		if f.name != "LRU" && kept < len(hot)/2 {
+			t.Errorf("%s: expect hot entries to survive the scan, but %d kept", f.name, kept)
+		}
+		t.Logf("%-10s %d/%d hot entries kept", f.name, kept, len(hot))
+	}
+}
+
+// TestHitRatio replays a Zipf trace interleaved with scans against each
+// policy, run with -v to see the hit ratios
+func TestHitRatio(t *testing.T) {
+	var trace []string
+	for i := 0; i < 10; i++ {
+		trace = append(trace, zipfTrace(20000, 10000, 1.01, int64(i))...)
+		trace = append(trace, scanTrace(2000, fmt.Sprintf("scan%d-", i))...)
+	}
+	ratios := make(map[string]float64)
+	for _, f := range factories {
+		ratios[f.name] = simulate(f.new(Config{MaxBytes: 500 * 64}), trace, 60)
+		t.Logf("%-10s hit ratio %.2f%%", f.name, ratios[f.name]*100)
+	}
+	for _, name := range []string{"ARC", "2Q", "W-TinyLFU"} {
+		if ratios[name] <= ratios["LRU"] {
+			t.Errorf("expect %s to beat LRU, but got %.4f <= %.4f", name, ratios[name], ratios["LRU"])
+		}
+	}
+}
+
+func BenchmarkPolicies(b *testing.B) {
+	trace := zipfTrace(1<<16, 1<<14, 1.01, 1)
+	for _, f := range factories {
+		b.Run(f.name, func(b *testing.B) {
+			p := f.new(Config{MaxBytes: 1 << 16})
+			b.ReportAllocs()
+			hits := 0
+			for i := 0; i < b.N; i++ {
+				key := trace[i&(len(trace)-1)]
+				if _, ok := p.Get(key); ok {
+					hits++
+				} else {
+					p.Add(key, sized(16), time.Time{})
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(b.N)*100, "hit%")
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	for _, f := range factories {
+		now := time.Now()
+		p := f.new(Config{Now: func() time.Time { return now }})
+		p.Add("k1", String("1"), now.Add(time.Second))
+		if v, ok := p.Peek("k1"); !ok || v.(String) != "1" {
+			t.Fatalf("%s: cache hit k1=1 failed", f.name)
+		}
+		now = now.Add(time.Second)
+		if _, ok := p.Peek("k1"); ok || p.Len() != 1 {
+			t.Fatalf("%s: Peek should miss expired k1 without removing it", f.name)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, f := range factories {
+		var reasons []lru.EvictReason
+		p := f.new(Config{OnEvicted: func(key string, value lru.Value, reason lru.EvictReason) {
+			reasons = append(reasons, reason)
+		}})
+		p.Add("k1", String("1"), time.Now().Add(time.Hour))
+		p.Add("k2", String("2"), time.Time{})
+		p.Remove("k1")
+		p.Remove("k3")
+		if _, ok := p.Get("k1"); ok || p.Len() != 1 || p.Bytes() != 3 || p.RemoveExpired() != 0 {
+			t.Fatalf("%s: Remove k1 failed", f.name)
+		}
+		if len(reasons) != 1 || reasons[0] != lru.Removed {
+			t.Fatalf("%s: expect k1 to be removed, but got %v", f.name, reasons)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// zipfTrace returns n lookups among keys distinct keys, whose popularity
+// follows Zipf's law of exponent s > 1. Key "0" is the most popular.
+func zipfTrace(n int, keys uint64, s float64, seed int64) []string {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(seed)), s, 1, keys-1)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = strconv.FormatUint(zipf.Uint64(), 10)
+	}
+	return trace
+}
+
+// scanTrace returns n lookups of distinct keys seen once, e.g. a batch job
+// reading every row
+func scanTrace(n int, prefix string) []string {
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = prefix + strconv.Itoa(i)
+	}
+	return trace
+}
+
+// sized is a value of size bytes
+type sized int
+
+func (s sized) Len() int { return int(s) }
+
+// simulate replays trace against p as a look-aside cache, adding a value of
+// size bytes on each miss, and returns the hit ratio
+func simulate(p Policy, trace []string, size int) float64 {
+	if len(trace) == 0 {
+		return 0
+	}
+	hits := 0
+	for _, key := range trace {
+		if _, ok := p.Get(key); ok {
+			hits++
+		} else {
+			p.Add(key, sized(size), time.Time{})
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
@@ -0,0 +1,80 @@
+package policy
+
+import "hash/fnv"
+
+// CountMinSketch estimates the frequencies of keys in little memory. It
+// never underestimates, and overestimates only on hash collisions. The
+// counters saturate at 15 and are halved every 10 * width increments so
+// that old popularity fades away.
+type CountMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+const (
+	sketchDepth = 4
+	sketchMax   = 15
+)
+
+// NewCountMinSketch returns a sketch of width counters per row, rounded up
+// to a power of two
+func NewCountMinSketch(width int) *CountMinSketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &CountMinSketch{mask: uint64(w - 1), resetAt: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// indexes returns the counter of key in each row, by double hashing
+func (s *CountMinSketch) indexes(key string) [sketchDepth]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum, sum>>32|sum<<32|1
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+// Increment counts an occurrence of key
+func (s *CountMinSketch) Increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < sketchMax {
+			s.rows[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.Reset()
+	}
+}
+
+// Estimate returns the estimated frequency of key
+func (s *CountMinSketch) Estimate(key string) int {
+	min := uint8(sketchMax)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return int(min)
+}
+
+// Reset halves all counters
+func (s *CountMinSketch) Reset() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
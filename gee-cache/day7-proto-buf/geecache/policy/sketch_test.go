@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCountMinSketch(t *testing.T) {
+	s := NewCountMinSketch(1000)
+	if len(s.rows[0]) != 1024 {
+		t.Fatalf("expect width 1024, but got %d", len(s.rows[0]))
+	}
+	for i := 0; i < 5; i++ {
+		s.Increment("hot")
+	}
+	s.Increment("cold")
+	if s.Estimate("hot") < 5 || s.Estimate("cold") < 1 || s.Estimate("none") > 1 {
+		t.Fatalf("bad estimates hot=%d cold=%d none=%d", s.Estimate("hot"), s.Estimate("cold"), s.Estimate("none"))
+	}
+	for i := 0; i < 20; i++ {
+		s.Increment("hot")
+	}
+	if s.Estimate("hot") != sketchMax {
+		t.Fatalf("expect counters to saturate at %d, but got %d", sketchMax, s.Estimate("hot"))
+	}
+
+	s.Reset()
+	if s.Estimate("hot") != sketchMax/2 || s.Estimate("cold") != 0 {
+		t.Fatalf("expect counters to be halved, but got hot=%d cold=%d", s.Estimate("hot"), s.Estimate("cold"))
+	}
+
+	// reset happens automatically after 10 * width increments
+	for i := 0; i < 10*1024; i++ {
+		s.Increment(strconv.Itoa(i))
+	}
+	if s.Estimate("hot") > sketchMax/2 {
+		t.Fatalf("expect aging, but got hot=%d", s.Estimate("hot"))
+	}
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"geecache/lru"
+	"time"
+)
+
+// TinyLFU is W-TinyLFU as in Caffeine: new entries go to a small LRU
+// window, and an entry leaving the window enters the main cache only if
+// it's estimated more frequent than the entry it would evict. The main
+// cache is a segmented LRU, entries hit in probation are promoted to
+// protected. Frequencies are estimated by a CountMinSketch of the lookups.
+type TinyLFU struct {
+	core
+	window     segment
+	probation  segment
+	protected  segment
+	sketch     *CountMinSketch
+	windowMax  int64
+	protectMax int64
+}
+
+// NewTinyLFU is the constructor of TinyLFU, the window takes 1% of the
+// budget and protected 80% of the rest
+func NewTinyLFU(c Config) Policy {
+	width := c.MaxBytes / 64
+	if width < 1024 {
+		width = 1024
+	} else if width > 1<<20 {
+		width = 1 << 20
+	}
+	p := &TinyLFU{
+		core:   newCore(c),
+		sketch: NewCountMinSketch(int(width)),
+	}
+	p.split()
+	return p
+}
+
+// split divides the budget between the window and protected
+func (c *TinyLFU) split() {
+	c.windowMax = c.MaxBytes / 100
+	if c.windowMax < 1 {
+		c.windowMax = 1
+	}
+	c.protectMax = (c.MaxBytes - c.windowMax) * 8 / 10
+}
+
+// Resize sets the budget, divides it again and evicts entries until the
+// cache fits. The sketch keeps its width.
+func (c *TinyLFU) Resize(maxBytes int64) {
+	c.MaxBytes = maxBytes
+	c.split()
+	for c.protected.bytes > c.protectMax {
+		c.demote()
+	}
+	c.fit()
+}
+
+// Add adds a value to the cache
+func (c *TinyLFU) Add(key string, value lru.Value, expire time.Time) {
+	if it, ok := c.items[key]; ok {
+		c.update(it, value, expire)
+		c.hit(it)
+	} else {
+		c.window.pushFront(c.insert(key, value, expire))
+	}
+	c.fit()
+}
+
+// fit admits the entries overflowing the window, and evicts entries until
+// the cache fits
+func (c *TinyLFU) fit() {
+	if c.MaxBytes == 0 {
+		return
+	}
+	for c.window.bytes > c.windowMax {
+		c.admit(c.window.back())
+	}
+	for c.full() {
+		// values updated to a larger size may overflow the main cache
+		victim := c.victim()
+		if victim == nil {
+			victim = c.window.back()
+		}
+		c.evict(victim)
+	}
+}
+
+// admit moves candidate from the window to probation, if it's more
+// frequent than the victims making room for it
+func (c *TinyLFU) admit(candidate *item) {
+	c.window.remove(candidate)
+	mainMax := c.MaxBytes - c.windowMax
+	freq := c.sketch.Estimate(candidate.key)
+	for c.probation.bytes+c.protected.bytes+candidate.size() > mainMax {
+		victim := c.victim()
+		if victim == nil || freq <= c.sketch.Estimate(victim.key) {
+			c.remove(candidate, lru.Evicted, unlinkSegment)
+			return
+		}
+		c.evict(victim)
+	}
+	c.probation.pushFront(candidate)
+}
+
+// victim returns the entry to evict from the main cache, nil if it's empty
+func (c *TinyLFU) victim() *item {
+	if it := c.probation.back(); it != nil {
+		return it
+	}
+	return c.protected.back()
+}
+
+func (c *TinyLFU) evict(it *item) {
+	c.remove(it, lru.Evicted, unlinkSegment)
+}
+
+func (c *TinyLFU) hit(it *item) {
+	switch it.seg {
+	case &c.window, &c.protected:
+		it.seg.moveToFront(it)
+	case &c.probation:
+		c.probation.remove(it)
+		c.protected.pushFront(it)
+		for c.protected.bytes > c.protectMax {
+			c.demote()
+		}
+	}
+}
+
+// demote moves the least recent protected entry to probation
+func (c *TinyLFU) demote() {
+	demoted := c.protected.back()
+	c.protected.remove(demoted)
+	c.probation.pushFront(demoted)
+}
+
+// Get looks up a key's value, counting the lookup in the sketch
+func (c *TinyLFU) Get(key string) (lru.Value, bool) {
+	c.sketch.Increment(key)
+	it, ok := c.lookup(key, unlinkSegment)
+	if !ok {
+		return nil, false
+	}
+	c.hit(it)
+	return it.value, true
+}
+
+// Remove removes the item of key
+func (c *TinyLFU) Remove(key string) {
+	c.removeKey(key, unlinkSegment)
+}
+
+// RemoveExpired removes the expired items
+func (c *TinyLFU) RemoveExpired() int {
+	return c.removeExpired(unlinkSegment)
+}
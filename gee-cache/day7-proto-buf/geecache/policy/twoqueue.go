@@ -0,0 +1,83 @@
+package policy
+
+import (
+	"geecache/lru"
+	"time"
+)
+
+// TwoQueue is the full 2Q of Johnson and Shasha, measured in bytes. New
+// entries go to the FIFO a1in, the keys evicted from it are remembered in
+// a1out, and an entry added again while remembered goes to the LRU am.
+// Entries referenced only once, e.g. by a scan, never reach am.
+type TwoQueue struct {
+	core
+	a1in  segment
+	am    segment
+	a1out ghosts
+	kin   int64 // budget of a1in
+	kout  int64 // budget of a1out
+}
+
+// NewTwoQueue is the constructor of TwoQueue, a1in takes a quarter of the
+// budget and a1out remembers keys of half the budget
+func NewTwoQueue(c Config) Policy {
+	return &TwoQueue{core: newCore(c), kin: c.MaxBytes / 4, kout: c.MaxBytes / 2}
+}
+
+// Add adds a value to the cache
+func (c *TwoQueue) Add(key string, value lru.Value, expire time.Time) {
+	if it, ok := c.items[key]; ok {
+		c.update(it, value, expire)
+		if it.seg == &c.am {
+			c.am.moveToFront(it)
+		}
+	} else if c.a1out.contains(key) {
+		c.a1out.remove(key)
+		c.am.pushFront(c.insert(key, value, expire))
+	} else {
+		c.a1in.pushFront(c.insert(key, value, expire))
+	}
+	c.fit()
+}
+
+// Resize sets the budget, and those of a1in and a1out in proportion, and
+// evicts entries until the cache fits
+func (c *TwoQueue) Resize(maxBytes int64) {
+	c.MaxBytes, c.kin, c.kout = maxBytes, maxBytes/4, maxBytes/2
+	c.a1out.trim(c.kout)
+	c.fit()
+}
+
+func (c *TwoQueue) fit() {
+	for c.full() {
+		if it := c.a1in.back(); it != nil && (c.a1in.bytes > c.kin || c.am.bytes == 0) {
+			c.a1out.add(it.key, it.size())
+			c.a1out.trim(c.kout)
+			c.remove(it, lru.Evicted, unlinkSegment)
+		} else {
+			c.remove(c.am.back(), lru.Evicted, unlinkSegment)
+		}
+	}
+}
+
+// Get looks up a key's value
+func (c *TwoQueue) Get(key string) (lru.Value, bool) {
+	it, ok := c.lookup(key, unlinkSegment)
+	if !ok {
+		return nil, false
+	}
+	if it.seg == &c.am {
+		c.am.moveToFront(it)
+	}
+	return it.value, true
+}
+
+// Remove removes the item of key
+func (c *TwoQueue) Remove(key string) {
+	c.removeKey(key, unlinkSegment)
+}
+
+// RemoveExpired removes the expired items
+func (c *TwoQueue) RemoveExpired() int {
+	return c.removeExpired(unlinkSegment)
+}
@@ -1,12 +1,46 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// errGoexit is the error of a call whose fn called runtime.Goexit
+var errGoexit = errors.New("runtime.Goexit was called")
+
+// A panicError is the value recovered from a panic of fn, with the stack
+// of the panic
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func (p *panicError) Unwrap() error {
+	err, _ := p.value.(error)
+	return err
+}
 
 // call is an in-flight or completed Do call
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{} // closed once fn returned
+	val  interface{}
+	err  error
+
+	// guarded by Group.mu. dups counts the callers that joined the first
+	// one, waiters the callers still waiting. cancel is the cancel of the
+	// context of DoContext calls, nil for the others.
+	dups    int
+	waiters int
+	chans   []chan<- Result
+	cancel  context.CancelFunc
 }
 
 // Group represents a class of work and forms a namespace in which
@@ -16,31 +50,192 @@ type Group struct {
 	m  map[string]*call // lazily initialized
 }
 
+// Result holds the results of Do, so they can be passed on a channel.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
+
 // Do executes and returns the results of the given function, making
 // sure that only one execution is in-flight for a given key at a
 // time. If a duplicate comes in, the duplicate caller waits for the
-// original to complete and receives the same results.
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// original to complete and receives the same results. shared tells
+// whether the results were given to several callers. If fn panics or
+// calls runtime.Goexit, so do all the callers.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		g.mu.Unlock()
+		<-c.done
+		return c.result()
+	}
+	c := &call{done: make(chan struct{}), waiters: 1}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.result()
+}
+
+// DoChan is like Do but returns a channel that will receive the results
+// when they are ready. A panic of fn crashes the program, as it can't be
+// recovered by the receivers.
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{done: make(chan struct{}), waiters: 1, chans: []chan<- Result{ch}}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext is like Do, but a caller gives up waiting when its ctx is
+// done and returns ctx.Err(). fn runs in its own goroutine with a context
+// carrying the values of the first caller's ctx, which is canceled once
+// every caller gave up, so that abandoned work doesn't go on. The deadline
+// of the first caller isn't kept on purpose, the later callers may wait
+// longer; fn sets its own timeout if it needs one. A panic of fn nobody
+// waits for anymore crashes the program.
+func (g *Group) DoContext(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
 		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		return g.wait(ctx, key, c)
 	}
-	c := new(call)
-	c.wg.Add(1)
+	fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	go func() {
+		defer cancel()
+		g.doCall(c, key, func() (interface{}, error) {
+			return fn(fctx)
+		})
+		if e, ok := c.err.(*panicError); ok && g.abandoned(c) {
+			panic(e)
+		}
+	}()
+	return g.wait(ctx, key, c)
+}
 
+// Forget tells the group to forget key, the next call of key runs fn
+// rather than waiting for an earlier call to complete.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
+
+// wait waits for c unless ctx is done first. The last caller to give up
+// cancels c, and a later caller of key starts a new call.
+func (g *Group) wait(ctx context.Context, key string, c *call) (interface{}, error, bool) {
+	select {
+	case <-c.done:
+		return c.result()
+	case <-ctx.Done():
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 && c.cancel != nil {
+		c.cancel()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+	}
+	return nil, ctx.Err(), c.dups > 0
+}
+
+// abandoned reports whether every caller of c gave up
+func (g *Group) abandoned(c *call) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return c.waiters == 0
+}
+
+// doCall runs fn for c, recovering a panic of fn, and publishes the
+// results. It publishes them too when fn calls runtime.Goexit.
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	recovered := false
+
+	defer func() {
+		if !normalReturn && !recovered {
+			c.err = errGoexit
+		}
+		g.finish(key, c)
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// recover returns nil on runtime.Goexit
+				if r := recover(); r != nil {
+					c.err = &panicError{value: r, stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// finish publishes the results of c to its waiters
+func (g *Group) finish(key string, c *call) {
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
 
-	return c.val, c.err
+	if e, ok := c.err.(*panicError); ok && len(c.chans) > 0 {
+		// crash rather than leave the receivers blocked forever, in a new
+		// goroutine so that the panic can't be recovered
+		go panic(e)
+		select {}
+	}
+	for _, ch := range c.chans {
+		ch <- Result{c.val, c.err, c.dups > 0}
+	}
+}
+
+// result returns the results of c to a caller, panicking or exiting the
+// goroutine like fn did
+func (c *call) result() (interface{}, error, bool) {
+	if e, ok := c.err.(*panicError); ok {
+		panic(e)
+	}
+	if c.err == errGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err, c.dups > 0
 }
@@ -1,16 +1,287 @@
 package singleflight
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDo(t *testing.T) {
 	var g Group
-	v, err := g.Do("key", func() (interface{}, error) {
+	v, err, shared := g.Do("key", func() (interface{}, error) {
 		return "bar", nil
 	})
 
-	if v != "bar" || err != nil {
-		t.Errorf("Do v = %v, error = %v", v, err)
+	if v != "bar" || err != nil || shared {
+		t.Errorf("Do v = %v, error = %v, shared = %v", v, err, shared)
 	}
 }
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("key", fn)
+			if v != "bar" || err != nil || !shared {
+				t.Errorf("Do v = %v, error = %v, shared = %v", v, err, shared)
+			}
+		}()
+	}
+	for g.waiters("key") != n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expect fn to be called once, but got %d", calls)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	someErr := errors.New("some error")
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return nil, someErr
+	})
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		t.Error("expect the call to be shared")
+		return nil, nil
+	})
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		if res := <-ch; res.Err != someErr || !res.Shared {
+			t.Fatalf("expect the shared error, but got %+v", res)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+	g.Forget("key")
+	// the forgotten call doesn't remove the new call of key when done
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 2, nil
+	})
+	close(release)
+	if res := <-ch1; res.Val != 1 {
+		t.Fatalf("expect 1, but got %v", res.Val)
+	}
+	if res := <-ch2; res.Val != 2 || res.Shared {
+		t.Fatalf("expect 2 from a new call, but got %+v", res)
+	}
+	if v, _, _ := g.Do("key", func() (interface{}, error) { return 3, nil }); v != 3 {
+		t.Fatalf("expect 3 from a new call, but got %v", v)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("invalid memory address or nil pointer dereference")
+	}
+
+	const n = 5
+	panics := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer func() {
+				panics <- recover()
+			}()
+			g.Do("key", fn)
+		}()
+	}
+	for g.waiters("key") != n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < n; i++ {
+		r := <-panics
+		if _, ok := r.(*panicError); !ok || !strings.Contains(r.(error).Error(), "nil pointer dereference") {
+			t.Fatalf("expect every caller to panic, but got %v", r)
+		}
+	}
+	// the key isn't stuck after the panic
+	if v, _, _ := g.Do("key", func() (interface{}, error) { return 1, nil }); v != 1 {
+		t.Fatalf("expect 1, but got %v", v)
+	}
+}
+
+func TestGoexitDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	}
+
+	const n = 5
+	exits := make(chan bool, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			returned := false
+			defer func() {
+				exits <- !returned && recover() == nil
+			}()
+			g.Do("key", fn)
+			returned = true
+		}()
+	}
+	for g.waiters("key") != n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < n; i++ {
+		if !<-exits {
+			t.Fatal("expect every caller to exit its goroutine")
+		}
+	}
+}
+
+func TestPanicDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	const n = 3
+	panics := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer func() {
+				panics <- recover()
+			}()
+			g.DoContext(context.Background(), "key", fn)
+		}()
+	}
+	for g.waiters("key") != n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < n; i++ {
+		if r, ok := (<-panics).(*panicError); !ok || r.value != "boom" {
+			t.Fatalf("expect every caller to panic with boom, but got %v", r)
+		}
+	}
+}
+
+func TestPanicDoChanCrashes(t *testing.T) {
+	if os.Getenv("TEST_PANIC_DOCHAN") != "" {
+		var g Group
+		ch := g.DoChan("key", func() (interface{}, error) {
+			panic("Panicking in DoChan")
+		})
+		<-ch
+		t.Fatal("expect DoChan to crash the program")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run="+t.Name(), "-test.v")
+	cmd.Env = append(os.Environ(), "TEST_PANIC_DOCHAN=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "Panicking in DoChan") {
+		t.Fatalf("expect the program to crash with the panic, but got %v:\n%s", err, out)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// a caller giving up doesn't cancel the call of the others
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() {
+		_, err, _ := g.DoContext(ctx, "key", fn)
+		errc <- err
+	}()
+	for g.waiters("key") != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	vc := make(chan interface{})
+	go func() {
+		v, _, shared := g.DoContext(context.Background(), "key", fn)
+		if !shared {
+			t.Error("expect the results to be shared")
+		}
+		vc <- v
+	}()
+	for g.waiters("key") != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expect context.Canceled, but got %v", err)
+	}
+	close(release)
+	if v := <-vc; v != "bar" {
+		t.Fatalf("expect bar, but got %v", v)
+	}
+
+	// the call is canceled once every caller gave up
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err, _ := g.DoContext(ctx, "key2", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expect the abandoned call to be canceled")
+	}
+}
+
+func (g *Group) waiters(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.m[key]; ok {
+		return c.waiters
+	}
+	return 0
+}
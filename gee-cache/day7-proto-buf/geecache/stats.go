@@ -0,0 +1,76 @@
+package geecache
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// MarshalJSON encodes i as a JSON number
+func (i *AtomicInt) MarshalJSON() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt
+	Loads          AtomicInt // (gets - cacheHits)
+	LoadsDeduped   AtomicInt // after singleflight
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	ServerRequests AtomicInt // gets that came over the network from peers
+}
+
+// Logger logs the errors and events of geecache, *log.Logger is a Logger
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type discard struct{}
+
+func (discard) Printf(format string, v ...interface{}) {}
+
+// loggerHolder keeps the concrete type stored in logger constant
+type loggerHolder struct {
+	Logger
+}
+
+var logger atomic.Value
+
+func init() {
+	SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+}
+
+// SetLogger replaces the logger of geecache, which logs to stderr by
+// default. A nil logger discards the logs.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discard{}
+	}
+	logger.Store(loggerHolder{l})
+}
+
+func logf(format string, v ...interface{}) {
+	logger.Load().(loggerHolder).Printf(format, v...)
+}
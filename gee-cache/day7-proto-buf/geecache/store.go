@@ -0,0 +1,47 @@
+package geecache
+
+import (
+	"context"
+	"time"
+)
+
+// A Store adapts a Group to the Get and Set of a key-value store with a
+// time to live, such as the CacheStore of the gee Cache middleware. A key
+// the getter fails to load is a miss, so the getter of a group used as a
+// store usually reports every key missing.
+type Store struct {
+	group   *Group
+	timeout time.Duration
+}
+
+// NewStore returns a Store of g, its calls give up after timeout, or never
+// if timeout is zero
+func NewStore(g *Group, timeout time.Duration) *Store {
+	return &Store{group: g, timeout: timeout}
+}
+
+func (s *Store) context() (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(context.Background(), s.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Get returns the value of key, and whether it was found
+func (s *Store) Get(key string) ([]byte, bool) {
+	ctx, cancel := s.context()
+	defer cancel()
+	v, err := s.group.Get(ctx, key)
+	if err != nil {
+		return nil, false
+	}
+	return v.ByteSlice(), true
+}
+
+// Set stores value as the value of key for ttl, or the TTL of the group if
+// ttl is zero. Errors are dropped, a value lost is a miss later.
+func (s *Store) Set(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := s.context()
+	defer cancel()
+	s.group.Set(ctx, key, value, ttl)
+}
@@ -0,0 +1,28 @@
+package geecache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// cacheStore is the CacheStore of the gee Cache middleware
+type cacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+func TestStore(t *testing.T) {
+	g := NewGroup("store", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("not found")
+	}))
+	defer g.Close()
+	var s cacheStore = NewStore(g, time.Second)
+	if _, ok := s.Get("GET /"); ok {
+		t.Fatal("expect a miss before Set")
+	}
+	s.Set("GET /", []byte("page"), time.Minute)
+	if v, ok := s.Get("GET /"); !ok || string(v) != "page" {
+		t.Fatalf("expect page, but got %q %v", v, ok)
+	}
+}
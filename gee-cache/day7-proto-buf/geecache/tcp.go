@@ -0,0 +1,602 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// The peers of a TCPPool keep a connection to each other, on which the
+// requests are multiplexed. Each request or response is a frame of
+//
+//	length uint32 | id uint64 | op uint8 | timeout uint32 | message
+//
+// in big endian, where length counts the bytes after it. The message of
+// a request is a pb.Request and op tells what to do with it, timeout is
+// the time left to the deadline of the request in milliseconds, 0 if it
+// has none. The message of a response is a pb.Response, or an error text
+// if op is opError, and its timeout is 0. A response has the id of its
+// request, and responses come in any order.
+const (
+	opGet byte = iota + 1
+	opSet
+	opRemove
+	opOK
+	opError
+)
+
+const (
+	frameHeaderLen = 17 // length, id, op and timeout
+	// maxFrameLen leaves room for a value of maxBodyLen, its key and group
+	maxFrameLen        = maxBodyLen + 1<<10
+	defaultDialTimeout = 5 * time.Second
+	// writeTimeout limits the time to write a frame. It doesn't depend on
+	// the request, a frame written in part breaks the connection.
+	writeTimeout = 10 * time.Second
+	// maxConnRequests limits the requests served at once on a connection,
+	// reading the next ones waits
+	maxConnRequests = 256
+)
+
+var errPoolClosed = errors.New("geecache: TCPPool closed")
+
+// TCPPoolOptions are the configurations of a TCPPool.
+type TCPPoolOptions struct {
+	// Replicas specifies the number of virtual nodes of each peer on the consistent hash.
+	// If blank, it defaults to 50.
+	Replicas int
+	// HashFn specifies the hash function of the consistent hash.
+	// If blank, it defaults to crc32.ChecksumIEEE.
+	HashFn consistenthash.Hash
+	// NewPicker creates the consistent hash picking the peer of a key,
+	// e.g. a consistenthash.Maglev. If nil, a consistenthash.Map of
+	// Replicas and HashFn is used.
+	NewPicker func() consistenthash.Picker
+	// DialTimeout limits the time to connect to a peer, 5s if zero.
+	DialTimeout time.Duration
+	// Timeout limits the time of a request to a peer, 10s if zero.
+	Timeout time.Duration
+}
+
+// TCPPool implements PeerPicker for a pool of peers talking a binary
+// protocol over TCP. It is an alternative to HTTPPool with less overhead
+// per request.
+type TCPPool struct {
+	// this peer's address, e.g. "10.0.0.1:8001"
+	self string
+	opts TCPPoolOptions
+
+	mu         sync.Mutex // guards the fields below
+	peers      consistenthash.Picker
+	tcpGetters map[string]*tcpGetter // keyed by e.g. "10.0.0.2:8001"
+	listeners  map[net.Listener]struct{}
+	conns      map[net.Conn]struct{} // served connections
+	closed     bool
+}
+
+// NewTCPPool initializes a TCP pool of peers, a nil o is the default
+// options.
+func NewTCPPool(self string, o *TCPPoolOptions) *TCPPool {
+	p := &TCPPool{
+		self:      self,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.DialTimeout == 0 {
+		p.opts.DialTimeout = defaultDialTimeout
+	}
+	if p.opts.Timeout == 0 {
+		p.opts.Timeout = defaultTimeout
+	}
+	return p
+}
+
+// Log info with server name
+func (p *TCPPool) Log(format string, v ...interface{}) {
+	logf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Set updates the pool's list of peers.
+func (p *TCPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opts.NewPicker != nil {
+		p.peers = p.opts.NewPicker()
+	} else {
+		p.peers = consistenthash.New(p.opts.Replicas, p.opts.HashFn)
+	}
+	p.peers.Add(peers...)
+	old := p.tcpGetters
+	p.tcpGetters = make(map[string]*tcpGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := old[peer]; ok {
+			p.tcpGetters[peer] = g
+			delete(old, peer)
+			continue
+		}
+		p.tcpGetters[peer] = &tcpGetter{addr: peer, opts: &p.opts}
+	}
+	for _, g := range old {
+		g.close()
+	}
+}
+
+// PickPeer picks a peer according to key
+func (p *TCPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.tcpGetters[peer], true
+	}
+	return nil, false
+}
+
+// PickPeers picks the n holders of key, see PeerPicker
+func (p *TCPPool) PickPeers(key string, n int) ([]PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	pos := -1
+	for i, peer := range p.peers.GetN(key, n) {
+		if peer == p.self {
+			pos = i
+			continue
+		}
+		peers = append(peers, p.tcpGetters[peer])
+	}
+	return peers, pos
+}
+
+// Peers returns the getters of all the peers except this one
+func (p *TCPPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]PeerGetter, 0, len(p.tcpGetters))
+	for peer, getter := range p.tcpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+var _ PeerPicker = (*TCPPool)(nil)
+
+// ListenAndServe listens on the address of this peer and serves the
+// requests of the other peers, see Serve.
+func (p *TCPPool) ListenAndServe() error {
+	l, err := net.Listen("tcp", p.self)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve accepts connections on l and serves the requests of the other
+// peers on them. It returns once l fails, or nil once the pool is closed.
+func (p *TCPPool) Serve(l net.Listener) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		l.Close()
+		return errPoolClosed
+	}
+	p.listeners[l] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.listeners, l)
+		p.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		if !p.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// track adds conn to the served connections unless the pool is closed
+func (p *TCPPool) track(conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.conns[conn] = struct{}{}
+	return true
+}
+
+// serveConn serves the requests of conn concurrently. The load of a
+// request is canceled after the timeout of its frame, or once conn is
+// closed.
+func (p *TCPPool) serveConn(conn net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := &frameWriter{conn: conn, w: bufio.NewWriter(conn)}
+	sem := make(chan struct{}, maxConnRequests)
+	for {
+		id, op, timeout, body, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				p.Log("reading from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		go func() {
+			defer func() { <-sem }()
+			ctx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			op, body := p.handle(ctx, op, body)
+			if err := w.write(id, op, 0, body); err != nil {
+				// a slow or gone reader, the other responses can't be sent
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// handle serves a request, and returns the op and message of the response
+func (p *TCPPool) handle(ctx context.Context, op byte, body []byte) (byte, []byte) {
+	req := &pb.Request{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		return opError, []byte("decoding request: " + err.Error())
+	}
+	group := GetGroup(req.Group)
+	if group == nil {
+		return opError, []byte("no such group: " + req.Group)
+	}
+
+	group.Stats.ServerRequests.Add(1)
+	res := &pb.Response{}
+	switch op {
+	case opGet:
+		view, err := group.getForPeer(ctx, req.Key)
+		if err != nil {
+			return opError, []byte(err.Error())
+		}
+		res.Value = view.ByteSlice()
+	case opSet:
+		group.setFromPeer(ctx, req.Key, req.Value, time.Duration(req.Ttl))
+	case opRemove:
+		group.removeLocally(req.Key)
+	default:
+		return opError, []byte(fmt.Sprintf("unknown op %d", op))
+	}
+
+	b, err := proto.Marshal(res)
+	if err != nil {
+		return opError, []byte(err.Error())
+	}
+	if len(b) > maxBodyLen {
+		return opError, []byte(fmt.Sprintf("value of %d bytes too large", len(res.Value)))
+	}
+	return opOK, b
+}
+
+// Close stops serving, and closes the connections to and from the peers.
+func (p *TCPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for l := range p.listeners {
+		l.Close()
+	}
+	for conn := range p.conns {
+		conn.Close()
+	}
+	for _, g := range p.tcpGetters {
+		g.close()
+	}
+	return nil
+}
+
+// tcpGetter is a PeerGetter sending the requests to a peer over a single
+// connection, dialed again when broken
+type tcpGetter struct {
+	addr string
+	opts *TCPPoolOptions
+
+	mu     sync.Mutex // guards conn and closed
+	conn   *tcpConn
+	closed bool
+}
+
+func (h *tcpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.call(ctx, opGet, in, out)
+}
+
+func (h *tcpGetter) Set(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.call(ctx, opSet, in, out)
+}
+
+func (h *tcpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.call(ctx, opRemove, in, out)
+}
+
+var _ PeerGetter = (*tcpGetter)(nil)
+
+func (h *tcpGetter) call(ctx context.Context, op byte, in *pb.Request, out *pb.Response) error {
+	if h.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.Timeout)
+		defer cancel()
+	}
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request: %v", err)
+	}
+	if len(body) > maxBodyLen {
+		return fmt.Errorf("value of %d bytes too large", len(in.Value))
+	}
+	c, err := h.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan tcpResult, 1)
+	id, err := c.register(ch)
+	if err != nil {
+		return err
+	}
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			c.unregister(id)
+			return context.DeadlineExceeded
+		}
+	}
+	if err := c.w.write(id, op, timeout, body); err != nil {
+		c.fail(err)
+		return err
+	}
+	select {
+	case res := <-ch:
+		if res.err != nil {
+			return res.err
+		}
+		if res.op != opOK {
+			return &peerError{string(res.body)}
+		}
+		if err := proto.Unmarshal(res.body, out); err != nil {
+			return fmt.Errorf("decoding response: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.unregister(id)
+		return ctx.Err()
+	}
+}
+
+// connect returns the connection to the peer, dialing it if needed. The
+// dial happens outside h.mu so that the callers waiting for it can give up
+// when their ctx is done, the connection of the first dial to finish is
+// kept and the others are closed.
+func (h *tcpGetter) connect(ctx context.Context) (*tcpConn, error) {
+	if c, err := h.current(); c != nil || err != nil {
+		return c, err
+	}
+	d := net.Dialer{Timeout: h.opts.DialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", h.addr)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		conn.Close()
+		return nil, errPoolClosed
+	}
+	if h.conn != nil && !h.conn.broken() {
+		conn.Close()
+		return h.conn, nil
+	}
+	h.conn = &tcpConn{
+		conn:    conn,
+		w:       frameWriter{conn: conn, w: bufio.NewWriter(conn)},
+		pending: make(map[uint64]chan<- tcpResult),
+	}
+	go h.conn.readLoop()
+	return h.conn, nil
+}
+
+// current returns the connection to the peer if it's usable
+func (h *tcpGetter) current() (*tcpConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, errPoolClosed
+	}
+	if h.conn != nil && !h.conn.broken() {
+		return h.conn, nil
+	}
+	return nil, nil
+}
+
+func (h *tcpGetter) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.conn != nil {
+		h.conn.fail(errPoolClosed)
+	}
+}
+
+// tcpConn is a connection to a peer, the responses are dispatched to
+// the pending requests by id
+type tcpConn struct {
+	conn net.Conn
+	w    frameWriter
+
+	mu      sync.Mutex // guards the fields below
+	nextID  uint64
+	pending map[uint64]chan<- tcpResult
+	err     error // why the connection broke, nil if it didn't
+}
+
+type tcpResult struct {
+	op   byte
+	body []byte
+	err  error
+}
+
+func (c *tcpConn) register(ch chan<- tcpResult) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.nextID++
+	c.pending[c.nextID] = ch
+	return c.nextID, nil
+}
+
+func (c *tcpConn) unregister(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *tcpConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+func (c *tcpConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		id, op, _, body, err := readFrame(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- tcpResult{op: op, body: body}
+		}
+	}
+}
+
+// fail breaks the connection, failing the pending requests with err
+func (c *tcpConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+		for id, ch := range c.pending {
+			ch <- tcpResult{err: err}
+			delete(c.pending, id)
+		}
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+// frameWriter writes the frames of concurrent requests or responses, each
+// within writeTimeout
+type frameWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+func (fw *frameWriter) write(id uint64, op byte, timeout time.Duration, body []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	var hdr [frameHeaderLen]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(frameHeaderLen-4+len(body)))
+	binary.BigEndian.PutUint64(hdr[4:], id)
+	hdr[12] = op
+	binary.BigEndian.PutUint32(hdr[13:], timeoutMillis(timeout))
+	if _, err := fw.w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(body); err != nil {
+		return err
+	}
+	return fw.w.Flush()
+}
+
+func readFrame(r *bufio.Reader) (id uint64, op byte, timeout time.Duration, body []byte, err error) {
+	var hdr [frameHeaderLen]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	n := binary.BigEndian.Uint32(hdr[0:])
+	if n < frameHeaderLen-4 || n > maxFrameLen {
+		return 0, 0, 0, nil, fmt.Errorf("bad frame length %d", n)
+	}
+	// read as the bytes come, a bad length doesn't allocate maxFrameLen
+	n -= frameHeaderLen - 4
+	if body, err = io.ReadAll(io.LimitReader(r, int64(n))); err != nil {
+		return
+	}
+	if len(body) < int(n) {
+		return 0, 0, 0, nil, io.ErrUnexpectedEOF
+	}
+	timeout = time.Duration(binary.BigEndian.Uint32(hdr[13:])) * time.Millisecond
+	return binary.BigEndian.Uint64(hdr[4:]), hdr[12], timeout, body, nil
+}
+
+// timeoutMillis rounds d up to milliseconds, so that a timeout under 1ms
+// isn't sent as 0, no timeout
+func timeoutMillis(d time.Duration) uint32 {
+	if d <= 0 {
+		return 0
+	}
+	ms := (d + time.Millisecond - 1) / time.Millisecond
+	if ms > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(ms)
+}
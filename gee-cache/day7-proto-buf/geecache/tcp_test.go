@@ -0,0 +1,349 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	pb "geecache/geecachepb"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTCPPool serves a TCPPool on a local port
+func startTCPPool(t testing.TB) (*TCPPool, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewTCPPool(l.Addr().String(), nil)
+	go pool.Serve(l)
+	return pool, l.Addr().String()
+}
+
+func TestTCPPool(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("tcp", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			switch key {
+			case "slow":
+				<-ctx.Done()
+				return nil, ctx.Err()
+			case "unknown":
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte("db:" + key), nil
+		}))
+	server, addr := startTCPPool(t)
+	client := NewTCPPool("client", nil)
+	defer client.Close()
+	client.Set(addr)
+	peer := client.tcpGetters[addr]
+
+	// concurrent requests share the connection
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			res := &pb.Response{}
+			if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: key}, res); err != nil || string(res.Value) != "db:"+key {
+				t.Errorf("expect db:%s, but got %s %v", key, res.Value, err)
+			}
+		}(fmt.Sprint("key", i))
+	}
+	wg.Wait()
+
+	req := &pb.Request{Group: gee.name, Key: "Tom", Value: []byte("630")}
+	if err := peer.Set(dummyCtx, req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "630" {
+		t.Fatalf("expect the value set, but got %s", view)
+	}
+	if err := peer.Remove(dummyCtx, req, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get(dummyCtx, "Tom"); view.String() != "db:Tom" {
+		t.Fatalf("expect the value to be loaded after Remove, but got %s", view)
+	}
+
+	err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "unknown"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "unknown not exist") {
+		t.Fatalf("expect the error of the getter, but got %v", err)
+	}
+	if err := peer.Get(dummyCtx, &pb.Request{Group: "nope", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("expect an error for an unknown group")
+	}
+	ctx, cancel := context.WithTimeout(dummyCtx, 20*time.Millisecond)
+	defer cancel()
+	if err := peer.Get(ctx, &pb.Request{Group: gee.name, Key: "slow"}, &pb.Response{}); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+
+	// the connection is dialed again after the peer restarts
+	server.Close()
+	if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatal("expect an error while the peer is down")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("can't listen on %s again: %v", addr, err)
+	}
+	server = NewTCPPool(addr, nil)
+	defer server.Close()
+	go server.Serve(l)
+	res := &pb.Response{}
+	if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "Tom"}, res); err != nil || string(res.Value) != "db:Tom" {
+		t.Fatalf("expect db:Tom after the restart, but got %s %v", res.Value, err)
+	}
+}
+
+func TestReadFrameLength(t *testing.T) {
+	var b bytes.Buffer
+	fw := &frameWriter{conn: nopConn{}, w: bufio.NewWriter(&b)}
+	fw.write(7, opGet, 1500*time.Microsecond, []byte("body"))
+	id, op, timeout, body, err := readFrame(bufio.NewReader(&b))
+	if err != nil || id != 7 || op != opGet || timeout != 2*time.Millisecond || string(body) != "body" {
+		t.Fatalf("expect frame 7 to be read back, but got %d %d %v %q %v", id, op, timeout, body, err)
+	}
+
+	hdr := make([]byte, frameHeaderLen)
+	binary.BigEndian.PutUint32(hdr, maxFrameLen+1)
+	if _, _, _, _, err := readFrame(bufio.NewReader(bytes.NewReader(hdr))); err == nil {
+		t.Fatal("expect a frame over maxFrameLen to be rejected")
+	}
+	binary.BigEndian.PutUint32(hdr, maxFrameLen)
+	if _, _, _, _, err := readFrame(bufio.NewReader(bytes.NewReader(hdr))); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect a truncated frame to fail, but got %v", err)
+	}
+}
+
+func TestTCPDeadline(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	canceled := make(chan struct{})
+	gee := NewGroup("tcp-deadline", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}))
+	server, addr := startTCPPool(t)
+	defer server.Close()
+	client := NewTCPPool("client", &TCPPoolOptions{Timeout: 20 * time.Millisecond})
+	defer client.Close()
+	client.Set(addr)
+
+	// the connection stays open, the load is canceled by the deadline of
+	// the request
+	peer := client.tcpGetters[addr]
+	if err := peer.Get(dummyCtx, &pb.Request{Group: gee.name, Key: "Tom"}, &pb.Response{}); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, but got %v", err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expect the load of the peer to be canceled at the deadline of the request")
+	}
+}
+
+// TestTCPPoolDisagree is TestHTTPPoolDisagree over TCP
+func TestTCPPoolDisagree(t *testing.T) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("tcp-disagree", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db:" + key), nil
+		}))
+	server, addr := startTCPPool(t)
+	defer server.Close()
+	client := NewTCPPool("client", nil)
+	defer client.Close()
+	client.Set(addr)
+	gee.RegisterPeers(client)
+
+	ctx, cancel := context.WithTimeout(dummyCtx, 2*time.Second)
+	defer cancel()
+	if view, err := gee.Get(ctx, "Tom"); err != nil || view.String() != "db:Tom" {
+		t.Fatalf("expect the other peer to load db:Tom itself, but got %s %v", view, err)
+	}
+	if st := &gee.Stats; st.PeerLoads.Get() != 1 || st.LocalLoads.Get() != 1 || st.ServerRequests.Get() != 1 {
+		t.Fatalf("expect a single request served from the getter, but got %+v", st)
+	}
+}
+
+// nopConn lets a frameWriter write to a buffer
+type nopConn struct{ net.Conn }
+
+func (nopConn) SetWriteDeadline(time.Time) error { return nil }
+
+// TestTCPNode is a node of TestTCPNodes, run in its own process since
+// the groups are global. It prints its address, reads the addresses of
+// all the nodes from stdin, and serves until stdin is closed.
+func TestTCPNode(t *testing.T) {
+	if os.Getenv("GEECACHE_TCP_NODE") == "" {
+		t.Skip("run by TestTCPNodes")
+	}
+	SetLogger(nil)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := l.Addr().String()
+	gee := NewGroup("tcp-nodes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(self + ":" + key), nil
+		}))
+	pool := NewTCPPool(self, nil)
+	defer pool.Close()
+	gee.RegisterPeers(pool)
+	fmt.Println("addr", self)
+
+	stdin := bufio.NewReader(os.Stdin)
+	line, err := stdin.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Set(strings.Fields(line)...)
+	go pool.Serve(l)
+	io.Copy(ioutil.Discard, stdin)
+}
+
+func TestTCPNodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts processes")
+	}
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	addrs := []string{}
+	var stdins []io.WriteCloser
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestTCPNode$")
+		cmd.Env = append(os.Environ(), "GEECACHE_TCP_NODE=1")
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Wait()
+		defer stdin.Close()
+		stdins = append(stdins, stdin)
+
+		out := bufio.NewScanner(stdout)
+		for out.Scan() {
+			if f := strings.Fields(out.Text()); len(f) == 2 && f[0] == "addr" {
+				addrs = append(addrs, f[1])
+				break
+			}
+		}
+		go io.Copy(ioutil.Discard, stdout)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expect the addresses of 2 nodes, but got %v", addrs)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := l.Addr().String()
+	addrs = append(addrs, self)
+	for _, stdin := range stdins {
+		fmt.Fprintln(stdin, strings.Join(addrs, " "))
+	}
+	gee := NewGroup("tcp-nodes", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(self + ":" + key), nil
+		}), WithHotCache(0, 0))
+	pool := NewTCPPool(self, nil)
+	defer pool.Close()
+	pool.Set(addrs...)
+	gee.RegisterPeers(pool)
+	go pool.Serve(l)
+
+	owners := make(map[string]bool)
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprint("key", i)
+		owner := pool.peers.Get(key)
+		owners[owner] = true
+		view, err := gee.Get(dummyCtx, key)
+		if err != nil || view.String() != owner+":"+key {
+			t.Fatalf("expect %s to be loaded by %s, but got %s %v", key, owner, view, err)
+		}
+	}
+	if len(owners) != 3 {
+		t.Fatalf("expect the keys to be spread over 3 nodes, but got %v", owners)
+	}
+
+	key := "key0"
+	for i := 1; pool.peers.Get(key) == self; i++ {
+		key = fmt.Sprint("key", i)
+	}
+	if err := gee.Set(dummyCtx, key, []byte("630"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get(dummyCtx, key); view.String() != "630" {
+		t.Fatalf("expect the value set on the owner, but got %s", view)
+	}
+	if err := gee.Remove(dummyCtx, key); err != nil {
+		t.Fatal(err)
+	}
+	if view, _ := gee.Get(dummyCtx, key); view.String() != pool.peers.Get(key)+":"+key {
+		t.Fatalf("expect the value to be loaded after Remove, but got %s", view)
+	}
+}
+
+func BenchmarkTransport(b *testing.B) {
+	SetLogger(nil)
+	defer SetLogger(log.New(os.Stderr, "", log.LstdFlags))
+	gee := NewGroup("bench-transport", 64<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("value"), nil
+		}))
+	req := &pb.Request{Group: gee.name, Key: "Tom"}
+	bench := func(b *testing.B, peer PeerGetter) {
+		b.ReportAllocs()
+		b.RunParallel(func(p *testing.PB) {
+			for p.Next() {
+				if err := peer.Get(dummyCtx, req, &pb.Response{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	b.Run("HTTP", func(b *testing.B) {
+		srv := httptest.NewServer(NewHTTPPool("server"))
+		defer srv.Close()
+		client := NewHTTPPool("client")
+		client.Set(srv.URL)
+		bench(b, client.httpGetters[srv.URL])
+	})
+	b.Run("TCP", func(b *testing.B) {
+		server, addr := startTCPPool(b)
+		defer server.Close()
+		client := NewTCPPool("client", nil)
+		defer client.Close()
+		client.Set(addr)
+		bench(b, client.tcpGetters[addr])
+	})
+}
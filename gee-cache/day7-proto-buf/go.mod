@@ -1,7 +1,9 @@
 module example
 
-go 1.13
+go 1.21
 
 require geecache v0.0.0
 
+require github.com/golang/protobuf v1.3.3 // indirect
+
 replace geecache => ./geecache
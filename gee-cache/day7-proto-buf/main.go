@@ -12,8 +12,10 @@ import (
 	"flag"
 	"fmt"
 	"geecache"
+	"geecache/gossip"
 	"log"
 	"net/http"
+	"strings"
 )
 
 var db = map[string]string{
@@ -22,7 +24,7 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
-func createGroup() *geecache.Group {
+func createGroup(holders int) *geecache.Group {
 	return geecache.NewGroup("scores", 2<<10, geecache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
@@ -30,22 +32,52 @@ func createGroup() *geecache.Group {
 				return []byte(v), nil
 			}
 			return nil, fmt.Errorf("%s not exist", key)
-		}))
+		}), geecache.WithHolders(holders))
 }
 
 func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
 	peers := geecache.NewHTTPPool(addr)
 	peers.Set(addrs...)
+	joinCluster(addr, peers.Set)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
 }
 
+func startTCPCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	peers := geecache.NewTCPPool(addr, nil)
+	peers.Set(addrs...)
+	joinCluster(addr, peers.Set)
+	gee.RegisterPeers(peers)
+	log.Println("geecache is running at", addr, "over tcp")
+	log.Fatal(peers.ListenAndServe())
+}
+
+var gossipAddr, seed string
+
+// joinCluster discovers the peers by gossip if -gossip is given, rather
+// than taking them from addrMap
+func joinCluster(addr string, set func(peers ...string)) {
+	if gossipAddr == "" {
+		return
+	}
+	node, err := gossip.New(&gossip.Config{Name: addr, BindAddr: gossipAddr, OnChange: set})
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("gossip is running at", node.Addr())
+	if seed != "" {
+		if _, err := node.Join(seed); err != nil {
+			log.Println("failed to join", seed, err)
+		}
+	}
+}
+
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key)
+			view, err := gee.Get(r.Context(), key)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -62,8 +94,14 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 func main() {
 	var port int
 	var api bool
+	var transport string
+	var holders int
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&transport, "transport", "http", "Transport between the peers, http or tcp")
+	flag.IntVar(&holders, "holders", 1, "Peers holding each key, its owner included")
+	flag.StringVar(&gossipAddr, "gossip", "", "Gossip address, e.g. localhost:7001, to discover the peers")
+	flag.StringVar(&seed, "join", "", "Gossip address of a peer to join")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
@@ -77,10 +115,19 @@ func main() {
 	for _, v := range addrMap {
 		addrs = append(addrs, v)
 	}
+	if gossipAddr != "" {
+		addrs = []string{addrMap[port]}
+	}
 
-	gee := createGroup()
+	gee := createGroup(holders)
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
+	if transport == "tcp" {
+		for i, v := range addrs {
+			addrs[i] = strings.TrimPrefix(v, "http://")
+		}
+		startTCPCacheServer(strings.TrimPrefix(addrMap[port], "http://"), addrs, gee)
+	}
 	startCacheServer(addrMap[port], addrs, gee)
 }
@@ -0,0 +1,377 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ETag sets the ETag header of the response. For GET and HEAD requests
+// matching If-None-Match, it sends 304 Not Modified, skips the pending
+// handlers and returns true.
+// refer https://tools.ietf.org/html/rfc7232
+func (c *Context) ETag(etag string) bool {
+	if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+		etag = `"` + etag + `"`
+	}
+	c.SetHeader("ETag", etag)
+	if !c.conditional() {
+		return false
+	}
+	if match := c.Req.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+		c.notModified()
+		return true
+	}
+	return false
+}
+
+// LastModified sets the Last-Modified header of the response. For GET and
+// HEAD requests not modified since If-Modified-Since, it sends 304 Not
+// Modified, skips the pending handlers and returns true.
+func (c *Context) LastModified(t time.Time) bool {
+	t = t.UTC().Truncate(time.Second)
+	c.SetHeader("Last-Modified", t.Format(http.TimeFormat))
+	// If-None-Match takes precedence over If-Modified-Since
+	if !c.conditional() || c.Req.Header.Get("If-None-Match") != "" {
+		return false
+	}
+	since, err := http.ParseTime(c.Req.Header.Get("If-Modified-Since"))
+	if err == nil && !t.After(since) {
+		c.notModified()
+		return true
+	}
+	return false
+}
+
+func (c *Context) conditional() bool {
+	return c.Method == http.MethodGet || c.Method == http.MethodHead
+}
+
+func (c *Context) notModified() {
+	h := c.Writer.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	c.Status(http.StatusNotModified)
+	c.Abort()
+}
+
+// etagMatch uses the weak comparison required by If-None-Match
+func etagMatch(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheStore stores the responses captured by the Cache middleware, a
+// geecache.Store shares them between the peers of a geecache group
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+type memoryEntry struct {
+	value  []byte
+	expire time.Time
+}
+
+// MemoryStore is an in-memory CacheStore, safe for concurrent access
+type MemoryStore struct {
+	// MaxEntries is the number of entries kept at most. When it's reached,
+	// the expired entries are removed, then random ones if needed.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+const defaultMemoryStoreEntries = 10000
+
+// NewMemoryStore is the constructor of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MaxEntries: defaultMemoryStoreEntries,
+		entries:    make(map[string]memoryEntry),
+	}
+}
+
+// Get look ups a key's value, expired entries are removed
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.expire.IsZero() && time.Now().After(e.expire) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Set adds a value to the store, a ttl <= 0 means the value never expires
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expire = time.Now().Add(ttl)
+	}
+	if _, ok := s.entries[key]; !ok && s.MaxEntries > 0 && len(s.entries) >= s.MaxEntries {
+		s.makeRoom()
+	}
+	s.entries[key] = e
+}
+
+// makeRoom removes the expired entries, or a random tenth of the entries
+// if none expired
+func (s *MemoryStore) makeRoom() {
+	now := time.Now()
+	for k, e := range s.entries {
+		if !e.expire.IsZero() && now.After(e.expire) {
+			delete(s.entries, k)
+		}
+	}
+	if len(s.entries) < s.MaxEntries {
+		return
+	}
+	for k := range s.entries {
+		if len(s.entries) < s.MaxEntries-s.MaxEntries/10 {
+			break
+		}
+		delete(s.entries, k)
+	}
+}
+
+// cachedResponse is the stored form of a response
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// cacheWriter captures the response while writing it to the client. A
+// response flushed or hijacked, e.g. a stream, isn't cached.
+type cacheWriter struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	streamed bool
+}
+
+func (w *cacheWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.streamed = true
+		f.Flush()
+	}
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gee: response writer doesn't support hijacking")
+	}
+	w.streamed = true
+	return h.Hijack()
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Cache caches successful GET and HEAD responses in store for ttl, keyed
+// by method, host, request URI and the values of the vary headers. A
+// response with a shorter s-maxage or max-age is cached for that long, and
+// a response whose Vary names a header missing from vary isn't cached.
+// Responses marked private or no-store aren't cached, and the requests
+// carrying Authorization or Cookie only share responses marked public.
+// Requests with Cache-Control no-cache or max-age=0 skip the cached
+// response and refresh it. A nil store uses a new MemoryStore.
+func Cache(store CacheStore, ttl time.Duration, vary ...string) HandlerFunc {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	vary = append([]string(nil), vary...)
+	for i, name := range vary {
+		vary[i] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(vary)
+	return func(c *Context) {
+		if !c.conditional() {
+			c.Next()
+			return
+		}
+		key := cacheKey(c.Req, vary)
+		credentials := hasCredentials(c.Req)
+		// a client asking for a fresh response gets it cached below
+		if data, ok := store.Get(key); ok && !revalidate(c.Req.Header) {
+			var res cachedResponse
+			err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res)
+			if err == nil && (!credentials || cacheDirective(res.Header, "public")) {
+				c.serveCached(&res)
+				return
+			}
+		}
+
+		w := &cacheWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.status != http.StatusOK || w.streamed || !cacheable(w.Header()) {
+			return
+		}
+		if credentials && !cacheDirective(w.Header(), "public") {
+			return
+		}
+		if !varyCovered(w.Header(), vary) {
+			return
+		}
+		expire, ok := responseTTL(w.Header(), ttl)
+		if !ok {
+			return
+		}
+		var buf bytes.Buffer
+		res := cachedResponse{Status: w.status, Header: w.Header().Clone(), Body: w.body.Bytes()}
+		if err := gob.NewEncoder(&buf).Encode(&res); err == nil {
+			store.Set(key, buf.Bytes(), expire)
+		}
+	}
+}
+
+func cacheKey(req *http.Request, vary []string) string {
+	var key strings.Builder
+	key.WriteString(req.Method + " " + strings.ToLower(req.Host) + req.URL.RequestURI())
+	for _, name := range vary {
+		key.WriteString("\n" + name + "=" + strings.Join(req.Header[name], ","))
+	}
+	return key.String()
+}
+
+// cacheable reports whether a response may be shared between clients
+func cacheable(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	return !cacheDirective(header, "no-store") && !cacheDirective(header, "private")
+}
+
+// varyCovered reports whether the headers named by the Vary of header are
+// all in vary, the canonical headers of the cache key. Vary: * is never
+// covered.
+func varyCovered(header http.Header, vary []string) bool {
+	for _, v := range header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !containsString(vary, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// responseTTL returns how long the response of header may be cached, ttl
+// shortened to its s-maxage, or max-age if it has none. It reports false
+// if the response is stale already.
+func responseTTL(header http.Header, ttl time.Duration) (time.Duration, bool) {
+	age, ok := cacheDirectiveValue(header, "s-maxage")
+	if !ok {
+		age, ok = cacheDirectiveValue(header, "max-age")
+	}
+	if !ok {
+		return ttl, true
+	}
+	seconds, err := strconv.Atoi(age)
+	if err != nil {
+		return ttl, true
+	}
+	if seconds <= 0 {
+		return 0, false
+	}
+	if d := time.Duration(seconds) * time.Second; ttl <= 0 || d < ttl {
+		return d, true
+	}
+	return ttl, true
+}
+
+// cacheDirective reports whether the Cache-Control of header has directive
+func cacheDirective(header http.Header, directive string) bool {
+	_, ok := cacheDirectiveValue(header, directive)
+	return ok
+}
+
+// cacheDirectiveValue returns the value of directive in the Cache-Control
+// of header, and whether it's present
+func cacheDirectiveValue(header http.Header, directive string) (string, bool) {
+	for _, cc := range header["Cache-Control"] {
+		for _, d := range strings.Split(cc, ",") {
+			var value string
+			if i := strings.IndexByte(d, '='); i >= 0 {
+				d, value = d[:i], strings.Trim(strings.TrimSpace(d[i+1:]), `"`)
+			}
+			if strings.EqualFold(strings.TrimSpace(d), directive) {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// revalidate reports whether the request asks not to be served a stored
+// response, with Cache-Control no-cache or max-age=0
+func revalidate(header http.Header) bool {
+	if cacheDirective(header, "no-cache") {
+		return true
+	}
+	maxAge, ok := cacheDirectiveValue(header, "max-age")
+	return ok && maxAge == "0"
+}
+
+// hasCredentials reports whether req identifies its client, so that the
+// response may be personal
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+}
+
+func (c *Context) serveCached(res *cachedResponse) {
+	h := c.Writer.Header()
+	for k, v := range res.Header {
+		h[k] = v
+	}
+	c.Abort()
+	if etag := res.Header.Get("ETag"); etag != "" && c.ETag(etag) {
+		return
+	}
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil && c.LastModified(t) {
+		return
+	}
+	c.Status(res.Status)
+	if c.Method != http.MethodHead {
+		c.Writer.Write(res.Body)
+	}
+}
@@ -0,0 +1,257 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func serve(r http.Handler, method string, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestETag(t *testing.T) {
+	r := New()
+	r.GET("/", func(c *Context) {
+		if c.ETag("v1") {
+			return
+		}
+		c.String(http.StatusOK, "hello")
+	})
+
+	w := serve(r, "GET", "/", nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"v1"` {
+		t.Fatalf("expect 200 with ETag \"v1\", but got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	w = serve(r, "GET", "/", http.Header{"If-None-Match": {`"v0", W/"v1"`}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expect 304 without body, but got %d %q", w.Code, w.Body.String())
+	}
+	w = serve(r, "GET", "/", http.Header{"If-None-Match": {`"v0"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200 for stale etag, but got %d", w.Code)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	modified := time.Date(2020, 1, 9, 1, 0, 0, 0, time.UTC)
+	r := New()
+	r.GET("/", func(c *Context) {
+		if c.LastModified(modified) {
+			return
+		}
+		c.String(http.StatusOK, "hello")
+	})
+
+	w := serve(r, "GET", "/", http.Header{"If-Modified-Since": {modified.Format(http.TimeFormat)}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expect 304, but got %d", w.Code)
+	}
+	since := modified.Add(-time.Hour).Format(http.TimeFormat)
+	w = serve(r, "GET", "/", http.Header{"If-Modified-Since": {since}})
+	if w.Code != http.StatusOK || w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+		t.Fatalf("expect 200 with Last-Modified, but got %d", w.Code)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var count int
+	r := New()
+	r.Use(Cache(nil, time.Minute, "Accept-Language"))
+	r.GET("/hello", func(c *Context) {
+		count++
+		c.ETag("v1")
+		c.String(http.StatusOK, "hello %s", c.Req.Header.Get("Accept-Language"))
+	})
+	r.GET("/private", func(c *Context) {
+		count++
+		c.SetHeader("Cache-Control", "private")
+		c.String(http.StatusOK, "private")
+	})
+
+	for i := 0; i < 3; i++ {
+		if w := serve(r, "GET", "/hello", nil); w.Body.String() != "hello " || w.Code != http.StatusOK {
+			t.Fatalf("expect 200 hello, but got %d %q", w.Code, w.Body.String())
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expect handler called once, but got %d", count)
+	}
+
+	w := serve(r, "GET", "/hello", http.Header{"Accept-Language": {"zh"}})
+	if w.Body.String() != "hello zh" || count != 2 {
+		t.Fatalf("expect vary header to miss the cache, but got %q", w.Body.String())
+	}
+	w = serve(r, "GET", "/hello", http.Header{"If-None-Match": {`"v1"`}})
+	if w.Code != http.StatusNotModified || count != 2 {
+		t.Fatalf("expect 304 from cache, but got %d", w.Code)
+	}
+	for i, cc := range []string{"no-cache", "max-age=0"} {
+		w = serve(r, "GET", "/hello", http.Header{"Cache-Control": {cc}})
+		if w.Body.String() != "hello " || count != 3+i {
+			t.Fatalf("expect Cache-Control: %s to reach the handler, but got %q after %d calls", cc, w.Body.String(), count)
+		}
+	}
+
+	serve(r, "GET", "/private", nil)
+	serve(r, "GET", "/private", nil)
+	if count != 6 {
+		t.Fatalf("expect private response not cached, but handler called %d times", count)
+	}
+}
+
+// ttlStore records the ttl of the responses stored
+type ttlStore struct {
+	*MemoryStore
+	ttl map[string]time.Duration
+}
+
+func (s *ttlStore) Set(key string, value []byte, ttl time.Duration) {
+	s.ttl[key] = ttl
+	s.MemoryStore.Set(key, value, ttl)
+}
+
+func TestCacheResponseHeaders(t *testing.T) {
+	store := &ttlStore{MemoryStore: NewMemoryStore(), ttl: make(map[string]time.Duration)}
+	r := New()
+	r.Use(Cache(store, time.Minute, "accept-language"))
+	r.GET("/:path", func(c *Context) {
+		switch c.Param("path") {
+		case "short":
+			c.SetHeader("Cache-Control", "public, max-age=10")
+		case "shared":
+			c.SetHeader("Cache-Control", "max-age=10, s-maxage=20")
+		case "long":
+			c.SetHeader("Cache-Control", "max-age=3600")
+		case "stale":
+			c.SetHeader("Cache-Control", "max-age=0")
+		case "vary":
+			c.SetHeader("Vary", "Accept-Language")
+		case "vary-encoding":
+			c.SetHeader("Vary", "Accept-Language, Accept-Encoding")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	expect := map[string]time.Duration{
+		"/short":  10 * time.Second,
+		"/shared": 20 * time.Second,
+		"/long":   time.Minute,
+		"/vary":   time.Minute,
+	}
+	for _, path := range []string{"/short", "/shared", "/long", "/stale", "/vary", "/vary-encoding"} {
+		serve(r, "GET", path, nil)
+	}
+	if len(store.ttl) != len(expect) {
+		t.Fatalf("expect %d responses stored, but got %v", len(expect), store.ttl)
+	}
+	for path, ttl := range expect {
+		if got := store.ttl["GET example.com"+path+"\nAccept-Language="]; got != ttl {
+			t.Fatalf("expect %s stored for %v, but got %v", path, ttl, got)
+		}
+	}
+}
+
+func TestCacheCredentials(t *testing.T) {
+	var count int
+	r := New()
+	r.Use(Cache(nil, time.Minute))
+	r.GET("/me", func(c *Context) {
+		count++
+		c.String(http.StatusOK, "hello %s", c.Req.Header.Get("Cookie"))
+	})
+	r.GET("/public", func(c *Context) {
+		count++
+		c.SetHeader("Cache-Control", "public, max-age=60")
+		c.String(http.StatusOK, "public")
+	})
+
+	if w := serve(r, "GET", "/me", http.Header{"Cookie": {"user=tom"}}); w.Body.String() != "hello user=tom" {
+		t.Fatalf("expect tom's page, but got %q", w.Body.String())
+	}
+	if w := serve(r, "GET", "/me", nil); w.Body.String() != "hello " || count != 2 {
+		t.Fatalf("expect a page requested with a cookie not to be shared, but got %q", w.Body.String())
+	}
+	if w := serve(r, "GET", "/me", http.Header{"Authorization": {"Basic amFjaw=="}}); w.Body.String() != "hello " || count != 3 {
+		t.Fatalf("expect a credentialed request to bypass the cache, but got %q", w.Body.String())
+	}
+
+	serve(r, "GET", "/public", http.Header{"Cookie": {"user=tom"}})
+	serve(r, "GET", "/public", http.Header{"Authorization": {"Basic amFjaw=="}})
+	serve(r, "GET", "/public", nil)
+	if count != 4 {
+		t.Fatalf("expect a public response to be shared, but handler called %d times", count)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	s.Set("k1", []byte("v1"), 0)
+	s.Set("k2", []byte("v2"), -time.Second)
+	s.Set("k3", []byte("v3"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if v, ok := s.Get("k1"); !ok || string(v) != "v1" {
+		t.Fatal("cache hit k1=v1 failed")
+	}
+	if _, ok := s.Get("k2"); !ok {
+		t.Fatal("expect ttl <= 0 never expires")
+	}
+	if _, ok := s.Get("k3"); ok {
+		t.Fatal("expect k3 expired")
+	}
+}
+
+func TestCacheHostAndStream(t *testing.T) {
+	var count int
+	r := New()
+	r.Use(Cache(nil, time.Minute))
+	r.GET("/", func(c *Context) {
+		count++
+		c.String(http.StatusOK, "%s", c.Req.Host)
+	})
+	r.GET("/stream", func(c *Context) {
+		count++
+		c.String(http.StatusOK, "event")
+		c.Writer.(http.Flusher).Flush()
+	})
+
+	if body := serveHost(r, "a.example.com", "/", nil); body != "a.example.com" {
+		t.Fatalf("expect a.example.com, but got %q", body)
+	}
+	if body := serveHost(r, "b.example.com", "/", nil); body != "b.example.com" || count != 2 {
+		t.Fatalf("expect the response of another host not to be served, but got %q", body)
+	}
+	serve(r, "GET", "/stream", nil)
+	serve(r, "GET", "/stream", nil)
+	if count != 4 {
+		t.Fatalf("expect flushed responses not cached, but handler called %d times", count)
+	}
+}
+
+func TestMemoryStoreMaxEntries(t *testing.T) {
+	s := NewMemoryStore()
+	s.MaxEntries = 10
+	s.Set("expired", []byte("v"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 9; i++ {
+		s.Set(strconv.Itoa(i), []byte("v"), 0)
+	}
+	s.Set("new", []byte("v"), 0)
+	if _, ok := s.entries["expired"]; ok || len(s.entries) != 10 {
+		t.Fatalf("expect the expired entry to make room, but got %d entries", len(s.entries))
+	}
+	for i := 0; i < 100; i++ {
+		s.Set("more"+strconv.Itoa(i), []byte("v"), 0)
+	}
+	if len(s.entries) > 10 {
+		t.Fatalf("expect at most 10 entries, but got %d", len(s.entries))
+	}
+}
@@ -0,0 +1,194 @@
+package gee
+
+import (
+	"net"
+	"strings"
+)
+
+// SetTrustedProxies sets the network addresses or CIDRs of the proxies
+// allowed to report the client through Forwarded, X-Forwarded-For and
+// X-Real-IP, e.g. "10.0.0.0/8" or "127.0.0.1". No proxy is trusted by default.
+func (engine *Engine) SetTrustedProxies(proxies []string) error {
+	cidrs := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return &net.ParseError{Type: "IP address", Text: proxy}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			cidrs = append(cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return err
+		}
+		cidrs = append(cidrs, cidr)
+	}
+	engine.trustedCIDRs = cidrs
+	return nil
+}
+
+func (engine *Engine) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range engine.trustedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop is one proxy hop reported by the request headers
+type forwardedHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// clientHop walks the proxy chain from the nearest hop and returns the
+// first hop not sent by a trusted proxy. ok is false if the direct peer
+// is not trusted or no forwarding header is present.
+func (c *Context) clientHop() (hop forwardedHop, ok bool) {
+	if c.engine == nil || !c.engine.isTrustedProxy(parseRemoteIP(c.Req.RemoteAddr)) {
+		return hop, false
+	}
+
+	var hops []forwardedHop
+	if values := c.Req.Header["Forwarded"]; len(values) > 0 {
+		hops = parseForwarded(values)
+	} else if values := c.Req.Header["X-Forwarded-For"]; len(values) > 0 {
+		for _, value := range values {
+			for _, item := range strings.Split(value, ",") {
+				hops = append(hops, forwardedHop{ip: parseForwardedIP(item)})
+			}
+		}
+		// each proxy appends its values, so they line up with the hops
+		// from the nearest one
+		for j, proto := range lastValues(c.Req.Header["X-Forwarded-Proto"], len(hops)) {
+			hops[j].proto = proto
+		}
+		for j, host := range lastValues(c.Req.Header["X-Forwarded-Host"], len(hops)) {
+			hops[j].host = host
+		}
+	} else if value := c.Req.Header.Get("X-Real-IP"); value != "" {
+		hops = append(hops, forwardedHop{ip: parseForwardedIP(value)})
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if hops[i].ip == nil {
+			// a malformed or obfuscated hop can't be walked past
+			return hops[i], false
+		}
+		if i == 0 || !c.engine.isTrustedProxy(hops[i].ip) {
+			// the hop was added by the trusted proxy the client connected
+			// to, the proto and host of the hops before it are the client's
+			return hops[i], true
+		}
+	}
+	return hop, false
+}
+
+// ClientIP returns the IP address of the client. Forwarding headers are
+// only honored when the request comes from a trusted proxy.
+func (c *Context) ClientIP() string {
+	if hop, ok := c.clientHop(); ok {
+		return hop.ip.String()
+	}
+	if ip := parseRemoteIP(c.Req.RemoteAddr); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// Scheme returns "http" or "https" as seen by the client
+func (c *Context) Scheme() string {
+	if hop, ok := c.clientHop(); ok && hop.proto != "" {
+		return strings.ToLower(hop.proto)
+	}
+	if c.Req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host requested by the client
+func (c *Context) Host() string {
+	if hop, ok := c.clientHop(); ok && hop.host != "" {
+		return hop.host
+	}
+	return c.Req.Host
+}
+
+func parseRemoteIP(addr string) net.IP {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return net.ParseIP(addr)
+}
+
+// parseForwarded parses RFC 7239 Forwarded header values,
+// e.g. for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			var hop forwardedHop
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v := strings.Trim(kv[1], `"`)
+				switch strings.ToLower(kv[0]) {
+				case "for":
+					hop.ip = parseForwardedIP(v)
+				case "proto":
+					hop.proto = v
+				case "host":
+					hop.host = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseForwardedIP parses a node such as 192.0.2.43, 192.0.2.43:47011,
+// [2001:db8:cafe::17]:4711 or 2001:db8:cafe::17. It returns nil for
+// "unknown" and obfuscated identifiers.
+func parseForwardedIP(node string) net.IP {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		if i := strings.Index(node, "]"); i > 0 {
+			return net.ParseIP(node[1:i])
+		}
+		return nil
+	}
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	return parseRemoteIP(node)
+}
+
+// lastValues splits values on commas and returns the last n items, padded
+// in front with "" to a length of n so that they line up with n hops
+func lastValues(values []string, n int) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	if len(items) > n {
+		items = items[len(items)-n:]
+	}
+	return append(make([]string, n-len(items)), items...)
+}
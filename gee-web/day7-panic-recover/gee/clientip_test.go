@@ -0,0 +1,101 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClientContext(remoteAddr string, header http.Header) *Context {
+	engine := New()
+	if err := engine.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"}); err != nil {
+		panic(err)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header = header
+	c := newContext(httptest.NewRecorder(), req)
+	c.engine = engine
+	return c
+}
+
+func TestClientIP(t *testing.T) {
+	testCases := []struct {
+		remoteAddr string
+		header     http.Header
+		expect     string
+	}{
+		{"203.0.113.9:1234", nil, "203.0.113.9"},
+		// untrusted peer can't spoof the client
+		{"203.0.113.9:1234", http.Header{"X-Forwarded-For": {"1.1.1.1"}}, "203.0.113.9"},
+		{"10.0.0.2:1234", http.Header{"X-Forwarded-For": {"1.1.1.1"}}, "1.1.1.1"},
+		{"10.0.0.2:1234", http.Header{"X-Forwarded-For": {"6.6.6.6, 1.1.1.1, 10.0.0.3"}}, "1.1.1.1"},
+		{"10.0.0.2:1234", http.Header{"X-Forwarded-For": {"6.6.6.6", "10.0.0.3"}}, "6.6.6.6"},
+		{"192.168.1.1:1234", http.Header{"X-Real-Ip": {"2.2.2.2"}}, "2.2.2.2"},
+		{"192.168.1.2:1234", http.Header{"X-Real-Ip": {"2.2.2.2"}}, "192.168.1.2"},
+		{"10.0.0.2:1234", http.Header{"Forwarded": {`for=192.0.2.60;proto=https, for="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"10.0.0.2:1234", http.Header{"Forwarded": {`for=192.0.2.60:80, for=10.1.1.1`}}, "192.0.2.60"},
+		{"10.0.0.2:1234", http.Header{"Forwarded": {`for=unknown`}}, "10.0.0.2"},
+		{"[::1]:1234", nil, "::1"},
+	}
+	for _, tc := range testCases {
+		c := newTestClientContext(tc.remoteAddr, tc.header)
+		if ip := c.ClientIP(); ip != tc.expect {
+			t.Errorf("remote %s, header %v: expect %s, but got %s", tc.remoteAddr, tc.header, tc.expect, ip)
+		}
+	}
+}
+
+func TestSchemeAndHost(t *testing.T) {
+	c := newTestClientContext("10.0.0.2:1234", http.Header{
+		"Forwarded": {`for=192.0.2.60;proto=https;host=example.com, for=10.1.1.1`},
+	})
+	if c.Scheme() != "https" || c.Host() != "example.com" {
+		t.Fatalf("expect https://example.com, but got %s://%s", c.Scheme(), c.Host())
+	}
+
+	c = newTestClientContext("10.0.0.2:1234", http.Header{
+		"X-Forwarded-For":   {"192.0.2.60"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	})
+	if c.Scheme() != "https" || c.Host() != "example.com" {
+		t.Fatalf("expect https://example.com, but got %s://%s", c.Scheme(), c.Host())
+	}
+
+	// values the client wrote before the trusted proxy are ignored
+	c = newTestClientContext("10.0.0.2:1234", http.Header{
+		"Forwarded": {`for=6.6.6.6;proto=https;host=evil, for=192.0.2.60`},
+	})
+	if c.Scheme() != "http" || c.Host() != c.Req.Host {
+		t.Fatalf("expect http://%s, but got %s://%s", c.Req.Host, c.Scheme(), c.Host())
+	}
+
+	c = newTestClientContext("10.0.0.2:1234", http.Header{
+		"X-Forwarded-For":   {"6.6.6.6, 192.0.2.60"},
+		"X-Forwarded-Proto": {"https, http"},
+		"X-Forwarded-Host":  {"evil", "example.com"},
+	})
+	if c.Scheme() != "http" || c.Host() != "example.com" {
+		t.Fatalf("expect http://example.com, but got %s://%s", c.Scheme(), c.Host())
+	}
+
+	c = newTestClientContext("203.0.113.9:1234", http.Header{
+		"X-Forwarded-For":   {"192.0.2.60"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"example.com"},
+	})
+	if c.Scheme() != "http" || c.Host() != c.Req.Host {
+		t.Fatalf("expect http://%s, but got %s://%s", c.Req.Host, c.Scheme(), c.Host())
+	}
+}
+
+func TestSetTrustedProxies(t *testing.T) {
+	engine := New()
+	if err := engine.SetTrustedProxies([]string{"::1", "fd00::/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetTrustedProxies([]string{"10.0.0.256"}); err == nil {
+		t.Fatal("expect error for invalid proxy address")
+	}
+}
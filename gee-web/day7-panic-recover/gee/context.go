@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"gee/i18n"
+	"gee/tracing"
 )
 
 type H map[string]interface{}
@@ -16,6 +19,10 @@ type Context struct {
 	Path   string
 	Method string
 	Params map[string]string
+	// pattern of the matched route
+	fullPath string
+	// virtual host of the matched route, empty for the default host
+	routeHost string
 	// response info
 	StatusCode int
 	// middleware
@@ -23,6 +30,15 @@ type Context struct {
 	index    int
 	// engine pointer
 	engine *Engine
+	// tracer of the handlers, set by Tracing
+	tracer tracing.Tracer
+	// session
+	session      *Session
+	sessionName  string
+	sessionStore SessionStore
+	sessionErr   error
+	// localizer of the request locale, set by I18n
+	localizer *i18n.Localizer
 }
 
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
@@ -39,12 +55,21 @@ func (c *Context) Next() {
 	c.index++
 	s := len(c.handlers)
 	for ; c.index < s; c.index++ {
+		if c.tracer != nil {
+			c.traceHandler(c.handlers[c.index])
+			continue
+		}
 		c.handlers[c.index](c)
 	}
 }
 
-func (c *Context) Fail(code int, err string) {
+// Abort prevents pending handlers from being called
+func (c *Context) Abort() {
 	c.index = len(c.handlers)
+}
+
+func (c *Context) Fail(code int, err string) {
+	c.Abort()
 	c.JSON(code, H{"message": err})
 }
 
@@ -53,6 +78,12 @@ func (c *Context) Param(key string) string {
 	return value
 }
 
+// FullPath returns the pattern of the matched route, e.g. "/hello/:name",
+// or "" if no route is matched
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
 func (c *Context) PostForm(key string) string {
 	return c.Req.FormValue(key)
 }
@@ -95,7 +126,11 @@ func (c *Context) Data(code int, data []byte) {
 func (c *Context) HTML(code int, name string, data interface{}) {
 	c.SetHeader("Content-Type", "text/html")
 	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
+	tmpl := c.engine.htmlTemplates
+	if c.localizer != nil {
+		tmpl = c.engine.localizedTemplates(c.localizer)
+	}
+	if err := tmpl.ExecuteTemplate(c.Writer, name, data); err != nil {
 		c.Fail(500, err.Error())
 	}
 }
@@ -3,6 +3,7 @@ package gee
 import (
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"path"
 	"strings"
@@ -18,21 +19,50 @@ type (
 		middlewares []HandlerFunc // support middleware
 		parent      *RouterGroup  // support nesting
 		engine      *Engine       // all groups share a Engine instance
+		router      *router       // routes of the group's virtual host
+		host        *virtualHost  // nil for the default host
 	}
 
 	Engine struct {
 		*RouterGroup
 		router        *router
+		hosts         []*virtualHost     // virtual hosts, most specific first
 		groups        []*RouterGroup     // store all groups
+		routes        []*Route           // store all routes, in registration order
 		htmlTemplates *template.Template // for html render
 		funcMap       template.FuncMap   // for html render
+		localized     i18nTemplates      // html templates of each locale
+		trustedCIDRs  []*net.IPNet       // proxies allowed to report the client
+		// UseH2C enables HTTP/2 over cleartext TCP with prior knowledge,
+		// e.g. for internal traffic behind a load balancer. Only prior
+		// knowledge is supported: the upgrade of an HTTP/1.1 request with
+		// "Upgrade: h2c", deprecated by RFC 9113, is ignored and the
+		// request served over HTTP/1.1. It needs Go 1.24, the Run methods
+		// return an error on older versions.
+		UseH2C bool
+
+		// RedirectTrailingSlash redirects /foo/ to /foo if only /foo is
+		// registered, and the other way round. Otherwise both match.
+		// It must be set before registering routes.
+		RedirectTrailingSlash bool
+		// RedirectFixedPath redirects a path that doesn't match as is, e.g.
+		// /FOO or //foo/../foo, to the cleaned path of the route matching
+		// it case-insensitively
+		RedirectFixedPath bool
+		// CaseInsensitive matches the static parts of routes ignoring case
+		CaseInsensitive bool
+		// UseRawPath matches the escaped path of the URL, so that an
+		// encoded "/" in a param value doesn't separate parts
+		UseRawPath bool
+		// UnescapePathValues unescapes the params matched with UseRawPath
+		UnescapePathValues bool
 	}
 )
 
 // New is the constructor of gee.Engine
 func New() *Engine {
 	engine := &Engine{router: newRouter()}
-	engine.RouterGroup = &RouterGroup{engine: engine}
+	engine.RouterGroup = &RouterGroup{engine: engine, router: engine.router}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	return engine
 }
@@ -52,6 +82,8 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 		prefix: group.prefix + prefix,
 		parent: group,
 		engine: engine,
+		router: group.router,
+		host:   group.host,
 	}
 	engine.groups = append(engine.groups, newGroup)
 	return newGroup
@@ -62,20 +94,47 @@ func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
-func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) {
+func (group *RouterGroup) addRoute(method string, comp string, handler HandlerFunc) *Route {
 	pattern := group.prefix + comp
-	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	if group.host != nil {
+		log.Printf("Route %4s - %s%s", method, group.host, pattern)
+	} else {
+		log.Printf("Route %4s - %s", method, pattern)
+	}
+	group.router.addRoute(method, pattern, handler, group.engine.RedirectTrailingSlash)
+	route := &Route{Method: method, Pattern: pattern, host: group.host}
+	group.engine.routes = append(group.engine.routes, route)
+	return route
 }
 
 // GET defines the method to add GET request
-func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouterGroup) GET(pattern string, handler HandlerFunc) *Route {
+	return group.addRoute("GET", pattern, handler)
 }
 
 // POST defines the method to add POST request
-func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouterGroup) POST(pattern string, handler HandlerFunc) *Route {
+	return group.addRoute("POST", pattern, handler)
+}
+
+// Handle defines the method to add request of the given method
+func (group *RouterGroup) Handle(method string, pattern string, handler HandlerFunc) *Route {
+	return group.addRoute(method, pattern, handler)
+}
+
+// Any defines the method to add request of all common methods, it returns
+// the route of each method
+func (group *RouterGroup) Any(pattern string, handler HandlerFunc) []*Route {
+	routes := make([]*Route, 0, len(anyMethods))
+	for _, method := range anyMethods {
+		routes = append(routes, group.addRoute(method, pattern, handler))
+	}
+	return routes
+}
+
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
 }
 
 // create static handler
@@ -108,23 +167,66 @@ func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 }
 
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTemplates = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	// T is replaced by the translation of the request locale, see I18n
+	funcMap := template.FuncMap{"T": untranslated}
+	for name, fn := range engine.funcMap {
+		funcMap[name] = fn
+	}
+	engine.htmlTemplates = template.Must(template.New("").Funcs(funcMap).ParseGlob(pattern))
+	engine.resetLocalizedTemplates()
 }
 
 // Run defines the method to start a http server
 func (engine *Engine) Run(addr string) (err error) {
-	return http.ListenAndServe(addr, engine)
+	srv, err := engine.newServer(addr)
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServe()
 }
 
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	routers, params := engine.matchHost(req)
+	c := newContext(w, req)
+	if engine.useRawPath(req) {
+		c.Path = req.URL.RawPath
+	}
+	c.Params = params
+	c.engine = engine
+	r := engine.pickRouter(routers, c)
+	c.handlers = engine.middlewares(r, req.URL.Path)
+	r.handle(c)
+}
+
+// middlewares returns the middlewares of the groups of r and of their
+// parents, whose prefix matches path. The middlewares of the engine apply
+// to all hosts.
+func (engine *Engine) middlewares(r *router, path string) []HandlerFunc {
+	serving := map[*RouterGroup]bool{engine.RouterGroup: true}
+	for _, group := range engine.groups {
+		if group.router != r {
+			continue
+		}
+		for g := group; g != nil && !serving[g]; g = g.parent {
+			serving[g] = true
+		}
+	}
 	var middlewares []HandlerFunc
 	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
+		if serving[group] && hasPrefix(path, group.prefix, engine.CaseInsensitive) {
 			middlewares = append(middlewares, group.middlewares...)
 		}
 	}
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
-	engine.router.handle(c)
+	return middlewares
+}
+
+func (engine *Engine) useRawPath(req *http.Request) bool {
+	return engine.UseRawPath && req.URL.RawPath != ""
+}
+
+func hasPrefix(s string, prefix string, fold bool) bool {
+	if fold {
+		return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(s, prefix)
 }
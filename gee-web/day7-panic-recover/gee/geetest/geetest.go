@@ -0,0 +1,301 @@
+// Package geetest provides helpers to test gee handlers and middlewares.
+//
+//	e := geetest.New(t, r)
+//	e.POST("/users").WithJSON(gee.H{"name": "Tom"}).
+//		Expect().Status(200).JSONPath("user.name", "Tom")
+package geetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gee"
+)
+
+// TestingT is the subset of testing.TB used to report failures
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// CreateTestContext returns a fresh engine and a context for testing a
+// handler directly, see gee.NewTestContext
+func CreateTestContext(w http.ResponseWriter) (*gee.Context, *gee.Engine) {
+	return gee.NewTestContext(w)
+}
+
+// RunMiddleware runs mw alone on req. next, if not nil, is run as the rest
+// of the chain. It reports whether the rest of the chain ran, which it
+// does unless mw aborts it, e.g. with c.Abort or c.Fail: gee runs the
+// pending handlers after a middleware returning without calling c.Next.
+func RunMiddleware(mw gee.HandlerFunc, req *http.Request, next gee.HandlerFunc) (w *httptest.ResponseRecorder, nextRan bool) {
+	r := gee.New()
+	r.Use(mw, func(c *gee.Context) {
+		nextRan = true
+		if next != nil {
+			next(c)
+		}
+		// skip the router, there is no route to be matched
+		c.Abort()
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return
+}
+
+// Expect sends requests to a handler and checks the responses
+type Expect struct {
+	t       TestingT
+	handler http.Handler
+}
+
+// New is the constructor of Expect
+func New(t TestingT, handler http.Handler) *Expect {
+	return &Expect{t: t, handler: handler}
+}
+
+// Request builds a request of method to path
+func (e *Expect) Request(method string, path string) *Request {
+	return &Request{e: e, method: method, path: path, header: make(http.Header), query: make(url.Values)}
+}
+
+// GET builds a GET request
+func (e *Expect) GET(path string) *Request { return e.Request(http.MethodGet, path) }
+
+// POST builds a POST request
+func (e *Expect) POST(path string) *Request { return e.Request(http.MethodPost, path) }
+
+// PUT builds a PUT request
+func (e *Expect) PUT(path string) *Request { return e.Request(http.MethodPut, path) }
+
+// PATCH builds a PATCH request
+func (e *Expect) PATCH(path string) *Request { return e.Request(http.MethodPatch, path) }
+
+// DELETE builds a DELETE request
+func (e *Expect) DELETE(path string) *Request { return e.Request(http.MethodDelete, path) }
+
+// HEAD builds a HEAD request
+func (e *Expect) HEAD(path string) *Request { return e.Request(http.MethodHead, path) }
+
+// Request is a request under construction
+type Request struct {
+	e       *Expect
+	method  string
+	path    string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    []byte
+	err     error
+}
+
+// WithHeader sets a request header
+func (r *Request) WithHeader(key string, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query parameter
+func (r *Request) WithQuery(key string, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithCookie adds a cookie
+func (r *Request) WithCookie(cookie *http.Cookie) *Request {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// WithBody sets the raw request body
+func (r *Request) WithBody(body []byte) *Request {
+	r.body = body
+	return r
+}
+
+// WithJSON sets obj encoded as JSON as the request body
+func (r *Request) WithJSON(obj interface{}) *Request {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		r.err = fmt.Errorf("encoding JSON body: %v", err)
+	}
+	r.header.Set("Content-Type", "application/json")
+	return r.WithBody(body)
+}
+
+// WithForm sets form as an urlencoded request body
+func (r *Request) WithForm(form url.Values) *Request {
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.WithBody([]byte(form.Encode()))
+}
+
+func (r *Request) String() string {
+	return r.method + " " + r.path
+}
+
+// Build returns the http.Request
+func (r *Request) Build() *http.Request {
+	path := r.path
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		path += sep + r.query.Encode()
+	}
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req := httptest.NewRequest(r.method, path, body)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	for _, cookie := range r.cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+// Expect sends the request and returns the response to be checked
+func (r *Request) Expect() *Response {
+	if r.err != nil {
+		r.e.t.Helper()
+		r.e.t.Errorf("%s: %v", r, r.err)
+	}
+	w := httptest.NewRecorder()
+	r.e.handler.ServeHTTP(w, r.Build())
+	return &Response{t: r.e.t, req: r, Recorder: w}
+}
+
+// Response checks a response, each failed check is reported to t
+type Response struct {
+	Recorder *httptest.ResponseRecorder
+	t        TestingT
+	req      *Request
+}
+
+func (res *Response) fail(format string, args ...interface{}) {
+	res.t.Helper()
+	body := res.Recorder.Body.String()
+	if len(body) > 512 {
+		body = body[:512] + "..."
+	}
+	res.t.Errorf("%s: %s\nresponse: %d %s", res.req, fmt.Sprintf(format, args...), res.Recorder.Code, body)
+}
+
+// Status checks the status code
+func (res *Response) Status(code int) *Response {
+	res.t.Helper()
+	if res.Recorder.Code != code {
+		res.fail("expected status %d, got %d", code, res.Recorder.Code)
+	}
+	return res
+}
+
+// Header checks a response header
+func (res *Response) Header(key string, value string) *Response {
+	res.t.Helper()
+	if got := res.Recorder.Header().Get(key); got != value {
+		res.fail("expected header %s %q, got %q", key, value, got)
+	}
+	return res
+}
+
+// Body checks the whole response body
+func (res *Response) Body(body string) *Response {
+	res.t.Helper()
+	if got := res.Recorder.Body.String(); got != body {
+		res.fail("expected body %q, got %q", body, got)
+	}
+	return res
+}
+
+// Contains checks the response body contains s
+func (res *Response) Contains(s string) *Response {
+	res.t.Helper()
+	if !strings.Contains(res.Recorder.Body.String(), s) {
+		res.fail("expected body to contain %q", s)
+	}
+	return res
+}
+
+// Cookies returns the cookies set by the response
+func (res *Response) Cookies() []*http.Cookie {
+	return res.Recorder.Result().Cookies()
+}
+
+// JSON checks the response body equals obj once both are encoded as JSON
+func (res *Response) JSON(obj interface{}) *Response {
+	res.t.Helper()
+	var got interface{}
+	if err := json.Unmarshal(res.Recorder.Body.Bytes(), &got); err != nil {
+		res.fail("decoding JSON body: %v", err)
+		return res
+	}
+	if expected := normalize(obj); !reflect.DeepEqual(expected, got) {
+		res.fail("expected JSON %s, got %s", marshal(expected), marshal(got))
+	}
+	return res
+}
+
+// JSONPath checks the value at path of the JSON response body, path is
+// made of object keys and array indexes separated by dots, e.g. "users.0.name"
+func (res *Response) JSONPath(path string, value interface{}) *Response {
+	res.t.Helper()
+	var got interface{}
+	if err := json.Unmarshal(res.Recorder.Body.Bytes(), &got); err != nil {
+		res.fail("decoding JSON body: %v", err)
+		return res
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := got.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if got, ok = v[key]; !ok {
+				res.fail("JSON path %q: key %q not found", path, key)
+				return res
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				res.fail("JSON path %q: index %q out of range [0, %d)", path, key, len(v))
+				return res
+			}
+			got = v[i]
+		default:
+			res.fail("JSON path %q: %q is not an object or array", path, key)
+			return res
+		}
+	}
+	if expected := normalize(value); !reflect.DeepEqual(expected, got) {
+		res.fail("JSON path %q: expected %s, got %s", path, marshal(expected), marshal(got))
+	}
+	return res
+}
+
+// normalize returns v as decoded from JSON, e.g. int 1 becomes float64 1
+func normalize(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var n interface{}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return v
+	}
+	return n
+}
+
+func marshal(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -0,0 +1,125 @@
+package geetest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gee"
+)
+
+// fakeT records failures instead of failing the test
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func newTestEngine() *gee.Engine {
+	r := gee.New()
+	r.GET("/hello/:name", func(c *gee.Context) {
+		c.JSON(http.StatusOK, gee.H{
+			"name":  c.Param("name"),
+			"lang":  c.Query("lang"),
+			"items": []int{1, 2},
+		})
+	})
+	r.POST("/echo", func(c *gee.Context) {
+		c.SetHeader("X-Content-Type", c.Req.Header.Get("Content-Type"))
+		body := make([]byte, c.Req.ContentLength)
+		c.Req.Body.Read(body)
+		c.Data(http.StatusCreated, body)
+	})
+	return r
+}
+
+func TestExpect(t *testing.T) {
+	e := New(t, newTestEngine())
+	e.GET("/hello/geektutu").WithQuery("lang", "go").Expect().
+		Status(http.StatusOK).
+		Header("Content-Type", "application/json").
+		JSONPath("name", "geektutu").
+		JSONPath("lang", "go").
+		JSONPath("items.1", 2).
+		JSON(gee.H{"name": "geektutu", "lang": "go", "items": []int{1, 2}})
+
+	e.POST("/echo").WithJSON(gee.H{"a": 1}).Expect().
+		Status(http.StatusCreated).
+		Header("X-Content-Type", "application/json").
+		Body(`{"a":1}`)
+}
+
+func TestExpectFailures(t *testing.T) {
+	ft := &fakeT{}
+	e := New(ft, newTestEngine())
+	e.GET("/hello/geektutu").Expect().
+		Status(http.StatusNotFound).
+		JSONPath("name", "Tom").
+		JSONPath("items.5", 1).
+		JSONPath("missing", 1).
+		Contains("nothing")
+
+	expect := []string{
+		"GET /hello/geektutu: expected status 404, got 200",
+		`JSON path "name": expected "Tom", got "geektutu"`,
+		`JSON path "items.5": index "5" out of range [0, 2)`,
+		`JSON path "missing": key "missing" not found`,
+		`expected body to contain "nothing"`,
+	}
+	if len(ft.errors) != len(expect) {
+		t.Fatalf("expect %d failures, but got %d: %v", len(expect), len(ft.errors), ft.errors)
+	}
+	for i, msg := range expect {
+		if !strings.Contains(ft.errors[i], msg) {
+			t.Errorf("expect failure %q, but got %q", msg, ft.errors[i])
+		}
+	}
+}
+
+func TestRunMiddleware(t *testing.T) {
+	auth := func(c *gee.Context) {
+		if c.Req.Header.Get("Authorization") == "" {
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		c.Next()
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w, called := RunMiddleware(auth, req, nil)
+	if called || w.Code != http.StatusUnauthorized {
+		t.Fatalf("expect 401 without calling next, but got %d, next called %t", w.Code, called)
+	}
+
+	req.Header.Set("Authorization", "token")
+	w, called = RunMiddleware(auth, req, func(c *gee.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	if !called || w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("expect next to be called, but got %d %q", w.Code, w.Body.String())
+	}
+
+	// the chain goes on after a middleware not calling c.Next
+	_, called = RunMiddleware(func(c *gee.Context) {}, req, nil)
+	if !called {
+		t.Fatal("expect next to run after a middleware returning")
+	}
+}
+
+func TestCreateTestContext(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := CreateTestContext(w)
+	c.Params = map[string]string{"name": "geektutu"}
+	func(c *gee.Context) {
+		c.String(http.StatusOK, "hello %s", c.Param("name"))
+	}(c)
+	if w.Code != http.StatusOK || w.Body.String() != "hello geektutu" {
+		t.Fatalf("expect hello geektutu, but got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -1,3 +1,7 @@
 module gee
 
 go 1.13
+
+require gee/metrics v0.0.0
+
+replace gee/metrics => ./metrics
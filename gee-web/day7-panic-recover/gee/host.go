@@ -0,0 +1,193 @@
+package gee
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// virtualHost routes requests by Host and request headers to its own router
+type virtualHost struct {
+	pattern string   // e.g. "api.example.com" or "{tenant}.example.com", empty matches any host
+	labels  []string // pattern split by "."
+	wild    bool     // pattern has {param} labels
+	headers [][2]string
+	router  *router
+	// fallbacks are the routers tried in order when router has no route,
+	// the routers of the hosts a header host was created from
+	fallbacks []*router
+}
+
+func newVirtualHost(pattern string, headers [][2]string, fallbacks []*router) *virtualHost {
+	pattern = strings.ToLower(pattern)
+	vh := &virtualHost{
+		pattern:   pattern,
+		headers:   headers,
+		router:    newRouter(),
+		fallbacks: fallbacks,
+	}
+	if pattern != "" {
+		vh.labels = strings.Split(pattern, ".")
+	}
+	for _, label := range vh.labels {
+		if isHostParam(label) {
+			vh.wild = true
+		}
+	}
+	vh.router.host = vh.String()
+	return vh
+}
+
+// rank orders hosts by how specific their pattern is: literal hosts,
+// patterns with {param} labels, then any host
+func (vh *virtualHost) rank() int {
+	switch {
+	case vh.pattern == "":
+		return 0
+	case vh.wild:
+		return 1
+	}
+	return 2
+}
+
+func isHostParam(label string) bool {
+	return len(label) > 2 && label[0] == '{' && label[len(label)-1] == '}'
+}
+
+func (vh *virtualHost) String() string {
+	s := vh.pattern
+	for _, h := range vh.headers {
+		s += fmt.Sprintf("[%s=%s]", h[0], h[1])
+	}
+	return s
+}
+
+// match reports whether req is served by vh and returns the captured host params
+func (vh *virtualHost) match(req *http.Request) (map[string]string, bool) {
+	for _, h := range vh.headers {
+		values, ok := req.Header[http.CanonicalHeaderKey(h[0])]
+		if !ok || (h[1] != "" && !containsString(values, h[1])) {
+			return nil, false
+		}
+	}
+
+	params := make(map[string]string)
+	if vh.pattern == "" {
+		return params, true
+	}
+
+	host := strings.ToLower(req.Host)
+	// compare without port unless the pattern itself specifies one
+	if !strings.Contains(vh.pattern, ":") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) != len(vh.labels) {
+		return nil, false
+	}
+	for i, label := range vh.labels {
+		if isHostParam(label) {
+			if labels[i] == "" {
+				return nil, false
+			}
+			params[label[1:len(label)-1]] = labels[i]
+			continue
+		}
+		if label != labels[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Host creates a RouterGroup with its own router, which only serves requests
+// whose Host matches pattern. A label written as {name} matches any single
+// label and is available through c.Param("name"), e.g. "{tenant}.example.com".
+func (engine *Engine) Host(pattern string) *RouterGroup {
+	return engine.addHost(engine.RouterGroup, newVirtualHost(pattern, nil, nil))
+}
+
+// Header creates a RouterGroup with its own router, which only serves requests
+// matched by the group's host and carrying the header key with the given value.
+// An empty value only requires the header to be present. The new group has
+// the prefix and middlewares of group, and the requests matching none of its
+// routes are routed by the host of group.
+func (group *RouterGroup) Header(key, value string) *RouterGroup {
+	pattern := ""
+	var headers [][2]string
+	fallbacks := []*router{group.router}
+	if group.host != nil {
+		pattern = group.host.pattern
+		headers = append(headers, group.host.headers...)
+		fallbacks = append(fallbacks, group.host.fallbacks...)
+	}
+	headers = append(headers, [2]string{key, value})
+	return group.engine.addHost(group, newVirtualHost(pattern, headers, fallbacks))
+}
+
+// addHost adds vh, served by a new group nested in parent
+func (engine *Engine) addHost(parent *RouterGroup, vh *virtualHost) *RouterGroup {
+	engine.hosts = append(engine.hosts, vh)
+	// try the most specific hosts first: literal hosts, then patterns, then
+	// any host, and the most header constraints among the same host
+	sort.SliceStable(engine.hosts, func(i, j int) bool {
+		a, b := engine.hosts[i], engine.hosts[j]
+		if a.rank() != b.rank() {
+			return a.rank() > b.rank()
+		}
+		return len(a.headers) > len(b.headers)
+	})
+
+	newGroup := &RouterGroup{
+		prefix: parent.prefix,
+		parent: parent,
+		engine: engine,
+		router: vh.router,
+		host:   vh,
+	}
+	engine.groups = append(engine.groups, newGroup)
+	return newGroup
+}
+
+// matchHost returns the routers of the host serving req, the first one
+// tried first, and the captured host params
+func (engine *Engine) matchHost(req *http.Request) ([]*router, map[string]string) {
+	for _, vh := range engine.hosts {
+		if params, ok := vh.match(req); ok {
+			return append([]*router{vh.router}, vh.fallbacks...), params
+		}
+	}
+	return []*router{engine.router}, make(map[string]string)
+}
+
+// pickRouter returns the first of routers with a route for the request
+// of c, or else the first one redirecting it
+func (engine *Engine) pickRouter(routers []*router, c *Context) *router {
+	if len(routers) == 1 {
+		return routers[0]
+	}
+	for _, r := range routers {
+		if n, _ := r.searchRoute(c.Method, c.Path, engine.CaseInsensitive); n != nil {
+			return r
+		}
+	}
+	for _, r := range routers {
+		if r.redirectPath(engine, c.Method, c.Path, nil) != "" {
+			return r
+		}
+	}
+	return routers[0]
+}
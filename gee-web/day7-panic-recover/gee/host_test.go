@@ -0,0 +1,183 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestHostEngine() *Engine {
+	r := New()
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "default")
+	})
+	api := r.Host("api.example.com")
+	api.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "api")
+	})
+	api.Header("Accept-Version", "v2").GET("/", func(c *Context) {
+		c.String(http.StatusOK, "api v2")
+	})
+	tenant := r.Host("{tenant}.example.com")
+	tenant.GET("/users/:name", func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Param("tenant"), c.Param("name"))
+	})
+	return r
+}
+
+func serveHost(r *Engine, host string, path string, header http.Header) string {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Host = host
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestHost(t *testing.T) {
+	r := newTestHostEngine()
+	testCases := []struct {
+		host   string
+		path   string
+		header http.Header
+		expect string
+	}{
+		{"localhost:9999", "/", nil, "default"},
+		{"api.example.com", "/", nil, "api"},
+		{"API.example.com:8080", "/", nil, "api"},
+		{"api.example.com", "/", http.Header{"Accept-Version": {"v2"}}, "api v2"},
+		{"api.example.com", "/", http.Header{"Accept-Version": {"v1"}}, "api"},
+		{"geektutu.example.com", "/users/tom", nil, "geektutu tom"},
+		{"a.b.example.com", "/", nil, "default"},
+	}
+	for _, tc := range testCases {
+		if body := serveHost(r, tc.host, tc.path, tc.header); body != tc.expect {
+			t.Errorf("%s%s: expect %q, but got %q", tc.host, tc.path, tc.expect, body)
+		}
+	}
+}
+
+func TestHostMiddleware(t *testing.T) {
+	r := New()
+	var global, v1, api int
+	r.Use(func(c *Context) { global++ })
+	r.Group("/v1").Use(func(c *Context) { v1++ })
+	r.Host("api.example.com").Use(func(c *Context) { api++ })
+
+	serveHost(r, "api.example.com", "/v1/hello", nil)
+	if global != 1 || v1 != 0 || api != 1 {
+		t.Fatalf("expect middlewares of engine and host only, got global=%d v1=%d api=%d", global, v1, api)
+	}
+	serveHost(r, "localhost", "/v1/hello", nil)
+	if global != 2 || v1 != 1 || api != 1 {
+		t.Fatalf("expect middlewares of default host only, got global=%d v1=%d api=%d", global, v1, api)
+	}
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	r := New()
+	var host, v1, v2 int
+	api := r.Host("api.example.com")
+	api.Use(func(c *Context) { host++ })
+	api.Group("/users").Use(func(c *Context) { v1++ })
+	api.GET("/users", func(c *Context) {})
+	beta := api.Header("Accept-Version", "v2")
+	beta.Use(func(c *Context) { v2++ })
+	beta.GET("/users/:name", func(c *Context) {})
+
+	v2Header := http.Header{"Accept-Version": {"v2"}}
+	serveHost(r, "api.example.com", "/users/tom", v2Header)
+	if host != 1 || v1 != 0 || v2 != 1 {
+		t.Fatalf("expect middlewares of the header group and its parent, got host=%d v1=%d v2=%d", host, v1, v2)
+	}
+	serveHost(r, "api.example.com", "/users", v2Header)
+	if host != 2 || v1 != 1 || v2 != 1 {
+		t.Fatalf("expect middlewares of the fallback host only, got host=%d v1=%d v2=%d", host, v1, v2)
+	}
+}
+
+func TestHeaderFallback(t *testing.T) {
+	r := New()
+	var api int
+	host := r.Host("api.example.com")
+	host.Use(func(c *Context) { api++ })
+	host.GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "users")
+	})
+	host.Header("Accept-Version", "v2").GET("/", func(c *Context) {
+		c.String(http.StatusOK, "api v2")
+	})
+	host.Group("/v1").Header("X-Beta", "").GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "beta users")
+	})
+	r.Header("X-Debug", "1").GET("/debug", func(c *Context) {
+		c.String(http.StatusOK, "debug")
+	})
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "default")
+	})
+
+	testCases := []struct {
+		host   string
+		path   string
+		header http.Header
+		expect string
+	}{
+		{"api.example.com", "/", http.Header{"Accept-Version": {"v2"}}, "api v2"},
+		{"api.example.com", "/users", http.Header{"Accept-Version": {"v2"}}, "users"},
+		{"api.example.com", "/v1/users", http.Header{"X-Beta": {"on"}}, "beta users"},
+		{"api.example.com", "/users", http.Header{"X-Beta": {"on"}}, "users"},
+		{"localhost", "/debug", http.Header{"X-Debug": {"1"}}, "debug"},
+		{"localhost", "/", http.Header{"X-Debug": {"1"}}, "default"},
+	}
+	for _, tc := range testCases {
+		if body := serveHost(r, tc.host, tc.path, tc.header); body != tc.expect {
+			t.Errorf("%s%s %v: expect %q, but got %q", tc.host, tc.path, tc.header, tc.expect, body)
+		}
+	}
+	if api != 4 {
+		t.Fatalf("expect the middleware of the host to run for its header hosts, but ran %d times", api)
+	}
+}
+
+func TestHostBeforeHeader(t *testing.T) {
+	r := newTestHostEngine()
+	r.Header("X-Beta", "").GET("/", func(c *Context) {
+		c.String(http.StatusOK, "beta")
+	})
+	beta := http.Header{"X-Beta": {"1"}}
+	if body := serveHost(r, "api.example.com", "/", beta); body != "api" {
+		t.Fatalf("expect the literal host to win over an engine header, but got %q", body)
+	}
+	if body := serveHost(r, "example.com", "/", beta); body != "beta" {
+		t.Fatalf("expect the engine header on other hosts, but got %q", body)
+	}
+	if body := serveHost(r, "example.com", "/", nil); body != "default" {
+		t.Fatalf("expect default, but got %q", body)
+	}
+}
+
+func TestHeaderFallbackMatching(t *testing.T) {
+	r := New()
+	r.CaseInsensitive = true
+	r.RedirectTrailingSlash = true
+	r.GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "users")
+	})
+	r.Header("X-Beta", "").GET("/beta", func(c *Context) {
+		c.String(http.StatusOK, "beta")
+	})
+	beta := http.Header{"X-Beta": {"on"}}
+	if body := serveHost(r, "localhost", "/USERS", beta); body != "users" {
+		t.Fatalf("expect the fallback to match ignoring case, but got %q", body)
+	}
+	req := httptest.NewRequest("GET", "/users/", nil)
+	req.Header.Set("X-Beta", "on")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/users" {
+		t.Fatalf("expect the fallback to redirect /users/, but got %d %q", w.Code, w.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,105 @@
+package gee
+
+import (
+	"html/template"
+	"sync"
+
+	"gee/i18n"
+)
+
+// I18nOptions configures where I18n looks for the requested locale
+type I18nOptions struct {
+	// QueryParam is the query parameter of the locale, "lang" by default
+	QueryParam string
+	// CookieName is the cookie of the locale, "lang" by default
+	CookieName string
+	// NoCookie ignores the cookie, so that the responses don't vary on it
+	NoCookie bool
+}
+
+// I18n negotiates the locale of the request among the languages of bundle,
+// from the query parameter, then the cookie, then the Accept-Language
+// header, and sets Vary accordingly for caches. c.T translates to the locale, and so does T in html templates:
+//
+//	{{ T "apples" .Count }}
+func I18n(bundle *i18n.Bundle, opts *I18nOptions) HandlerFunc {
+	query, cookie := "lang", "lang"
+	vary := "Accept-Language, Cookie"
+	if opts != nil && opts.NoCookie {
+		cookie, vary = "", "Accept-Language"
+	}
+	if opts != nil && opts.QueryParam != "" {
+		query = opts.QueryParam
+	}
+	if opts != nil && opts.CookieName != "" && !opts.NoCookie {
+		cookie = opts.CookieName
+	}
+	return func(c *Context) {
+		prefs := []string{c.Query(query)}
+		if cookie != "" {
+			if ck, err := c.Req.Cookie(cookie); err == nil {
+				prefs = append(prefs, ck.Value)
+			}
+		}
+		prefs = append(prefs, i18n.ParseAcceptLanguage(c.Req.Header.Get("Accept-Language"))...)
+		c.localizer = bundle.Localizer(bundle.Match(prefs...))
+		c.SetHeader("Content-Language", c.localizer.Lang)
+		c.Writer.Header().Add("Vary", vary)
+		c.Next()
+	}
+}
+
+// Locale returns the locale negotiated by I18n, "" without I18n
+func (c *Context) Locale() string {
+	if c.localizer == nil {
+		return ""
+	}
+	return c.localizer.Lang
+}
+
+// T translates key to the locale of the request, see i18n.Localizer.T.
+// Without I18n it returns key.
+func (c *Context) T(key string, args ...interface{}) string {
+	if c.localizer == nil {
+		return key
+	}
+	return c.localizer.T(key, args...)
+}
+
+// untranslated is T of the html templates rendered without I18n
+func untranslated(key string, args ...interface{}) string {
+	return key
+}
+
+// i18nTemplates caches the html templates of each locale, whose T
+// translates to the locale
+type i18nTemplates struct {
+	mu sync.Mutex
+	// base is never executed, html/template can't clone executed templates
+	base      *template.Template
+	templates map[*i18n.Localizer]*template.Template
+}
+
+func (engine *Engine) resetLocalizedTemplates() {
+	engine.localized.mu.Lock()
+	defer engine.localized.mu.Unlock()
+	engine.localized.base = template.Must(engine.htmlTemplates.Clone())
+	engine.localized.templates = nil
+}
+
+func (engine *Engine) localizedTemplates(l *i18n.Localizer) *template.Template {
+	engine.localized.mu.Lock()
+	defer engine.localized.mu.Unlock()
+	if engine.localized.base == nil {
+		return engine.htmlTemplates
+	}
+	if t, ok := engine.localized.templates[l]; ok {
+		return t
+	}
+	t := template.Must(engine.localized.base.Clone()).Funcs(template.FuncMap{"T": l.T})
+	if engine.localized.templates == nil {
+		engine.localized.templates = make(map[*i18n.Localizer]*template.Template)
+	}
+	engine.localized.templates[l] = t
+	return t
+}
@@ -0,0 +1,27 @@
+//go:build go1.16
+// +build go1.16
+
+package i18n
+
+import "io/fs"
+
+// LoadFS loads the catalogs matching patterns in fsys, e.g. an embed.FS,
+// files must have the extension .json or .toml
+func (b *Bundle) LoadFS(fsys fs.FS, patterns ...string) error {
+	for _, pattern := range patterns {
+		files, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			if err := b.loadData(file, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build go1.16
+// +build go1.16
+
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, data := range testLocales {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	b := NewBundle("en")
+	if err := b.LoadFS(fsys, "locales/*"); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Localizer("zh-CN").T("apples", 3); s != "3 个苹果" {
+		t.Fatalf("expect 3 个苹果, but got %q", s)
+	}
+}
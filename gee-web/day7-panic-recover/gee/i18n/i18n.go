@@ -0,0 +1,333 @@
+// Package i18n translates messages with catalogs loaded from JSON or TOML
+// files, one file per language named after its tag, e.g. "en.json" or
+// "zh-CN.toml". A message is either a string or a set of plural forms:
+//
+//	{
+//		"hello": "Hello, %s!",
+//		"apples": {"one": "%d apple", "other": "%d apples"},
+//		"nav": {"home": "Home"}
+//	}
+//
+// Nested objects which are not plural forms are flattened to dotted keys,
+// e.g. "nav.home". It's independent of gee.
+//
+//	b := i18n.NewBundle("en")
+//	b.LoadGlob("locales/*")
+//	l := b.Localizer(b.Match(i18n.ParseAcceptLanguage(header)...))
+//	l.T("apples", 3) // 3 apples
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// message is a translation, forms maps plural categories to texts,
+// a message without plural forms only has "other"
+type message map[string]string
+
+// Bundle holds the catalogs of all languages
+type Bundle struct {
+	defaultLang string
+
+	mu         sync.RWMutex
+	catalogs   map[string]map[string]message // lower-cased tag -> key -> message
+	tags       map[string]string             // lower-cased tag -> tag
+	localizers map[string]*Localizer
+}
+
+// NewBundle is the constructor of Bundle, defaultLang is used when no
+// language requested is supported and for messages missing in a catalog
+func NewBundle(defaultLang string) *Bundle {
+	return &Bundle{
+		defaultLang: defaultLang,
+		catalogs:    make(map[string]map[string]message),
+		tags:        make(map[string]string),
+		localizers:  make(map[string]*Localizer),
+	}
+}
+
+// AddMessages adds messages of lang, values are strings, plural forms or
+// nested messages as decoded from a JSON object
+func (b *Bundle) AddMessages(lang string, messages map[string]interface{}) error {
+	flat := make(map[string]message)
+	if err := flatten("", messages, flat); err != nil {
+		return fmt.Errorf("i18n: %s: %v", lang, err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := strings.ToLower(lang)
+	if b.catalogs[key] == nil {
+		b.catalogs[key] = make(map[string]message)
+		b.tags[key] = lang
+	}
+	for k, m := range flat {
+		b.catalogs[key][k] = m
+	}
+	return nil
+}
+
+// LoadGlob loads the catalogs of the files matching patterns, files must
+// have the extension .json or .toml
+func (b *Bundle) LoadGlob(patterns ...string) error {
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if err := b.loadData(filepath.ToSlash(file), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadData loads the catalog in data, read from file
+func (b *Bundle) loadData(file string, data []byte) error {
+	ext := path.Ext(file)
+	messages := make(map[string]interface{})
+	var err error
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(data, &messages)
+	case ".toml":
+		messages, err = parseTOML(data)
+	default:
+		return fmt.Errorf("i18n: %s: unknown catalog format", file)
+	}
+	if err != nil {
+		return fmt.Errorf("i18n: %s: %v", file, err)
+	}
+	return b.AddMessages(strings.TrimSuffix(path.Base(file), ext), messages)
+}
+
+var pluralCategories = map[string]bool{"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true}
+
+func flatten(prefix string, v map[string]interface{}, flat map[string]message) error {
+	for k, value := range v {
+		key := prefix + k
+		switch value := value.(type) {
+		case string:
+			flat[key] = message{"other": value}
+		case map[string]interface{}:
+			if m, ok := pluralForms(value); ok {
+				flat[key] = m
+			} else if err := flatten(key+".", value, flat); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %q is not a string or an object", key)
+		}
+	}
+	return nil
+}
+
+// pluralForms returns v as a message if its keys are plural categories
+func pluralForms(v map[string]interface{}) (message, bool) {
+	if _, ok := v["other"]; !ok {
+		return nil, false
+	}
+	m := make(message)
+	for k, form := range v {
+		s, ok := form.(string)
+		if !ok || !pluralCategories[k] {
+			return nil, false
+		}
+		m[k] = s
+	}
+	return m, true
+}
+
+// Languages returns the tags of the loaded catalogs, sorted
+func (b *Bundle) Languages() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	langs := make([]string, 0, len(b.tags))
+	for _, tag := range b.tags {
+		langs = append(langs, tag)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Match returns the supported language best matching prefs, in order of
+// preference. A tag matches a catalog of the same tag, then a catalog of
+// its base language or of a region of it, e.g. "en-US" matches "en".
+// It returns the default language if none matches.
+func (b *Bundle) Match(prefs ...string) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, pref := range prefs {
+		pref = strings.ToLower(strings.Replace(pref, "_", "-", -1))
+		if pref == "" {
+			continue
+		}
+		if tag, ok := b.tags[pref]; ok {
+			return tag
+		}
+		base := baseLang(pref)
+		if tag, ok := b.tags[base]; ok {
+			return tag
+		}
+		var regions []string
+		for key, tag := range b.tags {
+			if baseLang(key) == base {
+				regions = append(regions, tag)
+			}
+		}
+		if len(regions) > 0 {
+			sort.Strings(regions)
+			return regions[0]
+		}
+	}
+	return b.defaultLang
+}
+
+func baseLang(tag string) string {
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// ParseAcceptLanguage returns the tags of an Accept-Language header,
+// sorted by quality. Tags of quality 0 and "*" are dropped.
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		tag := strings.TrimSpace(parts[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	result := make([]string, len(tags))
+	for i, t := range tags {
+		result[i] = t.tag
+	}
+	return result
+}
+
+// Localizer translates messages to a language
+type Localizer struct {
+	// Lang is the tag of the language
+	Lang   string
+	bundle *Bundle
+	chain  []string // catalogs looked up in order
+	plural PluralRule
+}
+
+// Localizer returns the localizer of lang, localizers are cached
+func (b *Bundle) Localizer(lang string) *Localizer {
+	key := strings.ToLower(lang)
+	b.mu.RLock()
+	l, ok := b.localizers[key]
+	b.mu.RUnlock()
+	if ok {
+		return l
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if l, ok := b.localizers[key]; ok {
+		return l
+	}
+	chain := []string{key}
+	if base := baseLang(key); base != key {
+		chain = append(chain, base)
+	}
+	if def := strings.ToLower(b.defaultLang); def != key {
+		chain = append(chain, def)
+	}
+	l = &Localizer{Lang: lang, bundle: b, chain: chain, plural: pluralRule(key)}
+	b.localizers[key] = l
+	return l
+}
+
+// T translates key, formatting the message with args as fmt.Sprintf does.
+// The plural form is selected by the first integer in args. Keys missing
+// in the catalog of the language and of the default language are returned
+// as is.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	l.bundle.mu.RLock()
+	var m message
+	for _, lang := range l.chain {
+		if m = l.bundle.catalogs[lang][key]; m != nil {
+			break
+		}
+	}
+	l.bundle.mu.RUnlock()
+	if m == nil {
+		return key
+	}
+	text := m["other"]
+	if len(m) > 1 {
+		if n, ok := count(args); ok {
+			if form, ok := m[l.plural(n)]; ok {
+				text = form
+			}
+		}
+	}
+	if len(args) == 0 || !strings.Contains(text, "%") {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// count returns the first integer in args
+func count(args []interface{}) (int, bool) {
+	for _, arg := range args {
+		switch n := arg.(type) {
+		case int:
+			return n, true
+		case int8:
+			return int(n), true
+		case int16:
+			return int(n), true
+		case int32:
+			return int(n), true
+		case int64:
+			return int(n), true
+		case uint:
+			return int(n), true
+		case uint8:
+			return int(n), true
+		case uint16:
+			return int(n), true
+		case uint32:
+			return int(n), true
+		case uint64:
+			return int(n), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,165 @@
+package i18n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testLocales = map[string]string{
+	"locales/en.json": `{
+		"hello": "Hello, %s!",
+		"apples": {"one": "%d apple", "other": "%d apples"},
+		"nav": {"home": "Home", "about": "About"}
+	}`,
+	"locales/zh-CN.toml": `
+# Simplified Chinese
+hello = "你好，%s！"
+nav.home = '首页'
+
+[apples]
+other = "%d 个苹果"
+`,
+	"locales/ru.toml": `[apples]
+one = "%d яблоко"
+few = "%d яблока"
+many = "%d яблок"
+other = "%d яблока"
+`,
+}
+
+func newTestBundle(t *testing.T) *Bundle {
+	dir, err := ioutil.TempDir("", "i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "locales"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range testLocales {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := NewBundle("en")
+	if err := b.LoadGlob(filepath.Join(dir, "locales", "*")); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLocalizer(t *testing.T) {
+	b := newTestBundle(t)
+	if langs := b.Languages(); !reflect.DeepEqual(langs, []string{"en", "ru", "zh-CN"}) {
+		t.Fatalf("expect en, ru and zh-CN, but got %v", langs)
+	}
+	tests := []struct {
+		lang, key string
+		args      []interface{}
+		expect    string
+	}{
+		{"en", "hello", []interface{}{"Tom"}, "Hello, Tom!"},
+		{"en", "apples", []interface{}{1}, "1 apple"},
+		{"en", "apples", []interface{}{2}, "2 apples"},
+		{"en", "nav.home", nil, "Home"},
+		{"zh-CN", "hello", []interface{}{"Tom"}, "你好，Tom！"},
+		{"zh-CN", "apples", []interface{}{1}, "1 个苹果"},
+		{"zh-CN", "nav.about", nil, "About"},
+		{"ru", "apples", []interface{}{1}, "1 яблоко"},
+		{"ru", "apples", []interface{}{22}, "22 яблока"},
+		{"ru", "apples", []interface{}{11}, "11 яблок"},
+		{"ru", "missing", nil, "missing"},
+	}
+	for _, tt := range tests {
+		if got := b.Localizer(tt.lang).T(tt.key, tt.args...); got != tt.expect {
+			t.Errorf("%s %s: expect %q, but got %q", tt.lang, tt.key, tt.expect, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	b := newTestBundle(t)
+	tests := []struct {
+		prefs  []string
+		expect string
+	}{
+		{[]string{"zh-cn"}, "zh-CN"},
+		{[]string{"zh"}, "zh-CN"},
+		{[]string{"zh_TW"}, "zh-CN"},
+		{[]string{"en-US"}, "en"},
+		{[]string{"fr", "ru-RU"}, "ru"},
+		{[]string{"fr"}, "en"},
+		{nil, "en"},
+	}
+	for _, tt := range tests {
+		if got := b.Match(tt.prefs...); got != tt.expect {
+			t.Errorf("%v: expect %s, but got %s", tt.prefs, tt.expect, got)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := ParseAcceptLanguage("fr;q=0.5, zh-CN, en-US;q=0.8, *;q=0.1, de;q=0")
+	if expect := []string{"zh-CN", "en-US", "fr"}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, but got %v", expect, got)
+	}
+}
+
+func TestPluralRules(t *testing.T) {
+	tests := []struct {
+		lang   string
+		counts map[int]string
+	}{
+		{"en", map[int]string{0: "other", 1: "one", 2: "other"}},
+		{"fr", map[int]string{0: "one", 1: "one", 2: "other"}},
+		{"pt-PT", map[int]string{0: "other", 1: "one"}},
+		{"ja", map[int]string{1: "other"}},
+		{"ru", map[int]string{1: "one", 3: "few", 5: "many", 12: "many", 21: "one", 104: "few"}},
+		{"pl", map[int]string{1: "one", 21: "many", 22: "few"}},
+		{"ar", map[int]string{0: "zero", 2: "two", 105: "few", 111: "many", 100: "other"}},
+	}
+	for _, tt := range tests {
+		rule := pluralRule(strings.ToLower(tt.lang))
+		for n, expect := range tt.counts {
+			if got := rule(n); got != expect {
+				t.Errorf("%s %d: expect %s, but got %s", tt.lang, n, expect, got)
+			}
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML([]byte(`
+a = "tab\té" # comment
+"b.c" = 'raw\n'
+[t.u]
+v = """
+line1 \
+  line2"""
+w = '''x
+y'''
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{
+		"a":   "tab\té",
+		"b.c": `raw\n`,
+		"t": map[string]interface{}{
+			"u": map[string]interface{}{"v": "line1 line2", "w": "x\ny"},
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("expect %v, but got %v", expect, got)
+	}
+
+	for _, src := range []string{`a = 1`, `a = "x`, "a = \"x\"\na = \"y\"", `[a`, `a = "x" b`} {
+		if _, err := parseTOML([]byte(src)); err == nil {
+			t.Errorf("expect error for %q", src)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package i18n
+
+import (
+	"strings"
+	"sync"
+)
+
+// PluralRule returns the plural category of n: "zero", "one", "two",
+// "few", "many" or "other"
+type PluralRule func(n int) string
+
+var (
+	pluralMu    sync.RWMutex
+	pluralRules = make(map[string]PluralRule)
+)
+
+// RegisterPluralRule sets the plural rule of lang, a base language or a tag
+func RegisterPluralRule(lang string, rule PluralRule) {
+	pluralMu.Lock()
+	defer pluralMu.Unlock()
+	pluralRules[strings.ToLower(lang)] = rule
+}
+
+// pluralRule returns the rule of tag, then of its base language.
+// Languages without a rule use the rule of English.
+func pluralRule(tag string) PluralRule {
+	pluralMu.RLock()
+	defer pluralMu.RUnlock()
+	if rule, ok := pluralRules[tag]; ok {
+		return rule
+	}
+	if rule, ok := pluralRules[baseLang(tag)]; ok {
+		return rule
+	}
+	return pluralOne
+}
+
+// the cardinal rules of CLDR for integers
+func pluralOther(n int) string { return "other" }
+
+func pluralOne(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralZeroOne(n int) string {
+	if n == 0 || n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralSlavic(n int) string {
+	n = abs(n)
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func pluralPolish(n int) string {
+	n = abs(n)
+	switch {
+	case n == 1:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func pluralCzech(n int) string {
+	n = abs(n)
+	switch {
+	case n == 1:
+		return "one"
+	case n >= 2 && n <= 4:
+		return "few"
+	}
+	return "other"
+}
+
+func pluralArabic(n int) string {
+	n = abs(n)
+	switch {
+	case n == 0:
+		return "zero"
+	case n == 1:
+		return "one"
+	case n == 2:
+		return "two"
+	case n%100 >= 3 && n%100 <= 10:
+		return "few"
+	case n%100 >= 11:
+		return "many"
+	}
+	return "other"
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func init() {
+	for _, lang := range []string{"zh", "ja", "ko", "vi", "th", "id", "ms", "lo", "my"} {
+		pluralRules[lang] = pluralOther
+	}
+	for _, lang := range []string{"fr", "pt", "hi", "bn", "fa", "am"} {
+		pluralRules[lang] = pluralZeroOne
+	}
+	pluralRules["pt-pt"] = pluralOne
+	for _, lang := range []string{"ru", "uk", "be"} {
+		pluralRules[lang] = pluralSlavic
+	}
+	pluralRules["pl"] = pluralPolish
+	pluralRules["cs"] = pluralCzech
+	pluralRules["sk"] = pluralCzech
+	pluralRules["ar"] = pluralArabic
+}
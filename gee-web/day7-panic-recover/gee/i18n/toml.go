@@ -0,0 +1,278 @@
+package i18n
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML used by catalogs: tables, dotted
+// keys and string values, basic, literal and multi-line
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{src: string(data), line: 1}
+	root := make(map[string]interface{})
+	table := root
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			table, err = p.parseTable(root)
+		} else {
+			err = p.parseKeyValue(table)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", p.line, err)
+		}
+		p.skipSpace(false)
+		if !p.eof() && p.peek() != '\n' {
+			return nil, fmt.Errorf("line %d: expected end of line", p.line)
+		}
+	}
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+// skipSpace skips spaces and comments, and newlines too if newline
+func (p *tomlParser) skipSpace(newline bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newline:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) parseTable(root map[string]interface{}) (map[string]interface{}, error) {
+	p.pos++
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() || p.peek() != ']' {
+		return nil, fmt.Errorf("expected ]")
+	}
+	p.pos++
+	return descend(root, keys)
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.eof() || p.peek() != '=' {
+		return fmt.Errorf("expected =")
+	}
+	p.pos++
+	p.skipSpace(false)
+	value, err := p.parseString()
+	if err != nil {
+		return err
+	}
+	parent, err := descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := parent[last]; ok {
+		return fmt.Errorf("duplicate key %q", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// descend returns the table at keys, creating missing tables
+func descend(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		switch v := table[key].(type) {
+		case nil:
+			t := make(map[string]interface{})
+			table[key] = t
+			table = t
+		case map[string]interface{}:
+			table = v
+		default:
+			return nil, fmt.Errorf("key %q is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKey parses a dotted key of bare and quoted keys
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace(false)
+		if p.eof() {
+			return nil, fmt.Errorf("expected key")
+		}
+		var key string
+		if c := p.peek(); c == '"' || c == '\'' {
+			var err error
+			if key, err = p.parseString(); err != nil {
+				return nil, err
+			}
+		} else {
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if key = p.src[start:p.pos]; key == "" {
+				return nil, fmt.Errorf("invalid key")
+			}
+		}
+		keys = append(keys, key)
+		p.skipSpace(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.parseMultiline(`"""`, true)
+	case strings.HasPrefix(rest, "'''"):
+		return p.parseMultiline("'''", false)
+	case strings.HasPrefix(rest, `"`):
+		p.pos++
+		return p.parseBasic(`"`, false)
+	case strings.HasPrefix(rest, "'"):
+		end := strings.IndexAny(rest[1:], "'\n")
+		if end < 0 || rest[1+end] != '\'' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		p.pos += end + 2
+		return rest[1 : 1+end], nil
+	}
+	return "", fmt.Errorf("expected a string value")
+}
+
+func (p *tomlParser) parseMultiline(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+	// a newline right after the opening delimiter is trimmed
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos += 2
+		p.line++
+	} else if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.pos++
+		p.line++
+	}
+	if escapes {
+		return p.parseBasic(delim, true)
+	}
+	end := strings.Index(p.src[p.pos:], delim)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.line += strings.Count(s, "\n")
+	p.pos += end + len(delim)
+	return s, nil
+}
+
+// parseBasic parses a string with escapes until delim
+func (p *tomlParser) parseBasic(delim string, multiline bool) (string, error) {
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			p.pos += len(delim)
+			return b.String(), nil
+		}
+		c := p.peek()
+		switch {
+		case c == '\n' && !multiline:
+			return "", fmt.Errorf("unterminated string")
+		case c == '\\':
+			if err := p.parseEscape(&b, multiline); err != nil {
+				return "", err
+			}
+			continue
+		case c == '\n':
+			p.line++
+		}
+		b.WriteByte(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseEscape(b *strings.Builder, multiline bool) error {
+	p.pos++
+	if p.eof() {
+		return fmt.Errorf("unterminated string")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		b.WriteByte('\b')
+	case 't':
+		b.WriteByte('\t')
+	case 'n':
+		b.WriteByte('\n')
+	case 'f':
+		b.WriteByte('\f')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		b.WriteRune(rune(r))
+		p.pos += size
+	case ' ', '\t', '\r', '\n':
+		// a line ending backslash trims the following whitespace
+		if !multiline {
+			return fmt.Errorf("invalid escape \\%c", c)
+		}
+		for p.pos--; !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0; p.pos++ {
+			if p.peek() == '\n' {
+				p.line++
+			}
+		}
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package gee
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gee/i18n"
+)
+
+func newTestI18nEngine(t *testing.T) *Engine {
+	bundle := i18n.NewBundle("en")
+	bundle.AddMessages("en", map[string]interface{}{
+		"hello":  "Hello, %s!",
+		"apples": map[string]interface{}{"one": "%d apple", "other": "%d apples"},
+	})
+	bundle.AddMessages("zh-CN", map[string]interface{}{
+		"hello":  "你好，%s！",
+		"apples": "%d 个苹果",
+	})
+
+	dir, err := ioutil.TempDir("", "gee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmpl := `<p>{{ T "hello" .Name }} {{ T "apples" .Count }}</p>`
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.tmpl"), []byte(tmpl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.LoadHTMLGlob(filepath.Join(dir, "*"))
+	r.GET("/plain", func(c *Context) {
+		c.HTML(http.StatusOK, "index.tmpl", H{"Name": "Tom", "Count": 1})
+	})
+	g := r.Group("/i18n")
+	g.Use(I18n(bundle, nil))
+	g.GET("/hello", func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Locale(), c.T("hello", "Tom"))
+	})
+	g.GET("/page", func(c *Context) {
+		c.HTML(http.StatusOK, "index.tmpl", H{"Name": "Tom", "Count": 2})
+	})
+	return r
+}
+
+func TestI18nNegotiation(t *testing.T) {
+	r := newTestI18nEngine(t)
+	tests := []struct {
+		path   string
+		header http.Header
+		expect string
+	}{
+		{"/i18n/hello", nil, "en Hello, Tom!"},
+		{"/i18n/hello", http.Header{"Accept-Language": {"fr, zh;q=0.9, en;q=0.8"}}, "zh-CN 你好，Tom！"},
+		{"/i18n/hello", http.Header{"Cookie": {"lang=zh-CN"}, "Accept-Language": {"en"}}, "zh-CN 你好，Tom！"},
+		{"/i18n/hello?lang=en", http.Header{"Cookie": {"lang=zh-CN"}}, "en Hello, Tom!"},
+	}
+	for _, tt := range tests {
+		w := serve(r, "GET", tt.path, tt.header)
+		if w.Body.String() != tt.expect {
+			t.Errorf("%s %v: expect %q, but got %q", tt.path, tt.header, tt.expect, w.Body.String())
+		}
+	}
+	w := serve(r, "GET", "/i18n/hello", nil)
+	if w.Header().Get("Content-Language") != "en" {
+		t.Errorf("expect Content-Language en, but got %q", w.Header().Get("Content-Language"))
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept-Language, Cookie" {
+		t.Errorf("expect Vary on the cookie, but got %q", vary)
+	}
+}
+
+func TestI18nNoCookie(t *testing.T) {
+	bundle := i18n.NewBundle("en")
+	bundle.AddMessages("zh-CN", map[string]interface{}{"hello": "你好"})
+	r := New()
+	r.Use(I18n(bundle, &I18nOptions{NoCookie: true}))
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, c.Locale())
+	})
+	w := serve(r, "GET", "/", http.Header{"Cookie": {"lang=zh-CN"}})
+	if w.Body.String() != "en" {
+		t.Errorf("expect the cookie ignored, but got %q", w.Body.String())
+	}
+	if vary := w.Header().Get("Vary"); vary != "Accept-Language" {
+		t.Errorf("expect Vary: Accept-Language, but got %q", vary)
+	}
+}
+
+func TestI18nTemplates(t *testing.T) {
+	r := newTestI18nEngine(t)
+	// executing the templates without locale must not prevent cloning them
+	if w := serve(r, "GET", "/plain", nil); w.Body.String() != "<p>hello apples</p>" {
+		t.Fatalf("expect untranslated page, but got %q", w.Body.String())
+	}
+	for i := 0; i < 2; i++ {
+		w := serve(r, "GET", "/i18n/page", http.Header{"Accept-Language": {"zh-CN"}})
+		if w.Body.String() != "<p>你好，Tom！ 2 个苹果</p>" {
+			t.Fatalf("expect translated page, but got %q", w.Body.String())
+		}
+		w = serve(r, "GET", "/i18n/page", nil)
+		if w.Body.String() != "<p>Hello, Tom! 2 apples</p>" {
+			t.Fatalf("expect translated page, but got %q", w.Body.String())
+		}
+	}
+}
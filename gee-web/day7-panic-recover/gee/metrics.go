@@ -0,0 +1,127 @@
+package gee
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gee/metrics"
+)
+
+// sizeWriter counts the bytes of the response body
+type sizeWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (w *sizeWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sizeWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+func (w *sizeWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *sizeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("gee: response writer doesn't support hijacking")
+	}
+	return h.Hijack()
+}
+
+// httpMetrics are the metric families of the Metrics middleware
+type httpMetrics struct {
+	requests metrics.CounterVec
+	inFlight metrics.GaugeVec
+	latency  metrics.HistogramVec
+	size     metrics.HistogramVec
+}
+
+// registerHTTPMetrics registers the families in reg, or returns them if
+// another middleware registered them already
+func registerHTTPMetrics(reg *metrics.Registry) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.NewCounterVec("gee_http_requests_total",
+			"Number of HTTP requests.", "method", "route", "code"),
+		inFlight: reg.NewGaugeVec("gee_http_requests_in_flight",
+			"Number of HTTP requests being served.", "method", "route"),
+		latency: reg.NewHistogramVec("gee_http_request_duration_seconds",
+			"Latency of HTTP requests.", metrics.DefBuckets, "method", "route"),
+		size: reg.NewHistogramVec("gee_http_response_size_bytes",
+			"Size of HTTP responses.", metrics.ExponentialBuckets(64, 4, 8), "method", "route"),
+	}
+}
+
+// Metrics records request counts, in-flight requests, latencies and
+// response sizes in reg. They are labelled by the route pattern rather
+// than the path and methods outside the standard ones are labelled
+// "OTHER", so the number of series stays bounded. The routes of a
+// virtual host are prefixed with its pattern, e.g. "api.example.com/users".
+// Several middlewares may share reg, e.g. for several engines.
+func Metrics(reg *metrics.Registry) HandlerFunc {
+	m := registerHTTPMetrics(reg)
+	requests, inFlight, latency, size := m.requests, m.inFlight, m.latency, m.size
+
+	return func(c *Context) {
+		route := c.routeHost + c.FullPath()
+		if c.FullPath() == "" {
+			route = "unmatched"
+		}
+		method := metricsMethod(c.Method)
+		gauge := inFlight.WithLabelValues(method, route)
+		gauge.Inc()
+		defer gauge.Dec()
+
+		t := time.Now()
+		w := &sizeWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+			status := w.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			latency.WithLabelValues(method, route).Observe(time.Since(t).Seconds())
+			size.WithLabelValues(method, route).Observe(float64(w.size))
+		}()
+		c.Next()
+	}
+}
+
+// metricsMethod returns the label of method, clients may send any
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// MetricsHandler serves the metrics of reg in the Prometheus text format,
+// e.g. r.GET("/metrics", gee.MetricsHandler(reg))
+func MetricsHandler(reg *metrics.Registry) HandlerFunc {
+	return func(c *Context) {
+		reg.ServeHTTP(c.Writer, c.Req)
+	}
+}
@@ -0,0 +1,3 @@
+module gee/metrics
+
+go 1.13
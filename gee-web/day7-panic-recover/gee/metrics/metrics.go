@@ -0,0 +1,292 @@
+// Package metrics implements counters, gauges and histograms exposed in
+// the Prometheus text format, without any dependency outside the standard
+// library. It's a module of its own, gee/metrics, so that programs not
+// built on gee such as geecache and geerpc can use it too: require it and
+// replace it with its directory.
+//
+//	reg := metrics.NewRegistry()
+//	requests := reg.NewCounterVec("requests_total", "Number of requests.", "code")
+//	requests.WithLabelValues("200").Inc()
+//	http.Handle("/metrics", reg)
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var nameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// DefBuckets are the default histogram buckets, in seconds for latencies
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ExponentialBuckets returns count buckets, the first is start and each
+// following bucket is factor times the previous one
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// atomicFloat is a float64 updated atomically
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc increments the counter by 1
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Add adds v to the counter, it panics if v < 0
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(v)
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 { return c.v.Load() }
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) { g.v.Set(v) }
+
+// Inc increments the gauge by 1
+func (g *Gauge) Inc() { g.v.Add(1) }
+
+// Dec decrements the gauge by 1
+func (g *Gauge) Dec() { g.v.Add(-1) }
+
+// Add adds v to the gauge
+func (g *Gauge) Add(v float64) { g.v.Add(v) }
+
+// Value returns the current value
+func (g *Gauge) Value() float64 { return g.v.Load() }
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	upperBounds []float64
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{upperBounds: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.Add(v)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 { return atomic.LoadUint64(&h.count) }
+
+// Sum returns the sum of observations
+func (h *Histogram) Sum() float64 { return h.sum.Load() }
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// vec holds the children of a metric family keyed by label values
+type vec struct {
+	name     string
+	help     string
+	typ      metricType
+	labels   []string
+	buckets  []float64 // of histograms
+	mu       sync.RWMutex
+	children map[string]interface{}
+	values   map[string][]string
+	newChild func() interface{}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[key]; !ok {
+		child = v.newChild()
+		v.children[key] = child
+		v.values[key] = append([]string(nil), values...)
+	}
+	return child
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct{ *vec }
+
+// WithLabelValues returns the counter of the label values, created on first use
+func (v CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.with(values).(*Counter)
+}
+
+// GaugeVec is a family of gauges partitioned by labels
+type GaugeVec struct{ *vec }
+
+// WithLabelValues returns the gauge of the label values, created on first use
+func (v GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.with(values).(*Gauge)
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct{ *vec }
+
+// WithLabelValues returns the histogram of the label values, created on first use
+func (v HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.with(values).(*Histogram)
+}
+
+// Registry holds metric families and exposes them
+type Registry struct {
+	mu   sync.RWMutex
+	vecs map[string]*vec
+}
+
+// NewRegistry is the constructor of Registry
+func NewRegistry() *Registry {
+	return &Registry{vecs: make(map[string]*vec)}
+}
+
+// DefaultRegistry is a registry ready to use
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) register(v *vec) *vec {
+	if !nameRE.MatchString(v.name) {
+		panic("metrics: invalid metric name " + v.name)
+	}
+	for _, label := range v.labels {
+		if !nameRE.MatchString(label) || strings.HasPrefix(label, "__") || label == "le" {
+			panic("metrics: invalid label name " + label)
+		}
+	}
+	v.children = make(map[string]interface{})
+	v.values = make(map[string][]string)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.vecs[v.name]; ok {
+		if !old.sameFamily(v) {
+			panic("metrics: duplicate metric " + v.name)
+		}
+		return old
+	}
+	r.vecs[v.name] = v
+	return v
+}
+
+// sameFamily reports whether o has the type, labels and buckets of v
+func (v *vec) sameFamily(o *vec) bool {
+	if v.typ != o.typ || len(v.labels) != len(o.labels) || len(v.buckets) != len(o.buckets) {
+		return false
+	}
+	for i := range v.labels {
+		if v.labels[i] != o.labels[i] {
+			return false
+		}
+	}
+	for i := range v.buckets {
+		if v.buckets[i] != o.buckets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NewCounterVec registers a counter family. Registering the same family
+// again returns it, it panics if name is taken by another family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) CounterVec {
+	return CounterVec{r.register(&vec{name: name, help: help, typ: counterType, labels: labels,
+		newChild: func() interface{} { return &Counter{} }})}
+}
+
+// NewGaugeVec registers a gauge family. Registering the same family again
+// returns it, it panics if name is taken by another family.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) GaugeVec {
+	return GaugeVec{r.register(&vec{name: name, help: help, typ: gaugeType, labels: labels,
+		newChild: func() interface{} { return &Gauge{} }})}
+}
+
+// NewHistogramVec registers a histogram family, nil buckets means
+// DefBuckets. Registering the same family again returns it, it panics if
+// name is taken by another family.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return HistogramVec{r.register(&vec{name: name, help: help, typ: histogramType, labels: labels, buckets: buckets,
+		newChild: func() interface{} { return newHistogram(buckets) }})}
+}
+
+// NewCounter registers a counter without labels
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+// NewHistogram registers a histogram without labels
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).WithLabelValues()
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("http_requests_total", "Number of requests.\nBy code.", "method", "code")
+	requests.WithLabelValues("GET", "200").Inc()
+	requests.WithLabelValues("GET", "200").Add(2)
+	requests.WithLabelValues("POST", `5"0\0`).Inc()
+	reg.NewGauge("in_flight", "").Set(3)
+	latency := reg.NewHistogram("latency_seconds", "Latency.", []float64{0.5, 0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		latency.Observe(v)
+	}
+	reg.NewCounterVec("unused_total", "No samples.", "code")
+
+	var sb strings.Builder
+	if err := reg.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	expect := `# HELP http_requests_total Number of requests.\nBy code.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",code="200"} 3
+http_requests_total{method="POST",code="5\"0\\0"} 1
+# TYPE in_flight gauge
+in_flight 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="0.5"} 3
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 2.45
+latency_seconds_count 4
+`
+	if sb.String() != expect {
+		t.Fatalf("expect\n%s\nbut got\n%s", expect, sb.String())
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("hits_total", "Hits.").Inc()
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != ContentType || !strings.Contains(w.Body.String(), "hits_total 1\n") {
+		t.Fatalf("unexpected response %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounterVec("c_total", "", "k")
+	h := reg.NewHistogram("h", "", nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter.WithLabelValues("a").Inc()
+				h.Observe(0.01)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := counter.WithLabelValues("a").Value(); v != 8000 {
+		t.Fatalf("expect 8000, but got %v", v)
+	}
+	if h.Count() != 8000 {
+		t.Fatalf("expect 8000 observations, but got %d", h.Count())
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("dup_total", "").Inc()
+	if c := reg.NewCounter("dup_total", ""); c.Value() != 1 {
+		t.Fatalf("expect the same family to be returned, but got %v", c.Value())
+	}
+	reg.NewHistogramVec("dup_seconds", "", nil, "route")
+	for name, fn := range map[string]func(){
+		"duplicate":    func() { reg.NewGauge("dup_total", "") },
+		"labels":       func() { reg.NewCounterVec("dup_total", "", "code") },
+		"buckets":      func() { reg.NewHistogramVec("dup_seconds", "", []float64{1}, "route") },
+		"invalid name": func() { reg.NewGauge("1bad", "") },
+		"label le":     func() { reg.NewHistogramVec("h2", "", nil, "le") },
+		"label count":  func() { reg.NewCounterVec("c2_total", "", "a").WithLabelValues() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expect panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ContentType is the content type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// ServeHTTP exposes the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.WriteText(w)
+}
+
+// WriteText writes the metrics in the Prometheus text format, sorted by
+// metric name and label values
+// refer https://prometheus.io/docs/instrumenting/exposition_formats/
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.vecs))
+	for name := range r.vecs {
+		names = append(names, name)
+	}
+	vecs := r.vecs
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		r.mu.RLock()
+		v := vecs[name]
+		r.mu.RUnlock()
+		v.writeText(bw)
+	}
+	return bw.Flush()
+}
+
+func (v *vec) writeText(w *bufio.Writer) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	v.mu.RUnlock()
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+
+	if v.help != "" {
+		w.WriteString("# HELP " + v.name + " " + helpEscaper.Replace(v.help) + "\n")
+	}
+	w.WriteString("# TYPE " + v.name + " " + string(v.typ) + "\n")
+	for _, key := range keys {
+		v.mu.RLock()
+		child, values := v.children[key], v.values[key]
+		v.mu.RUnlock()
+		switch m := child.(type) {
+		case *Counter:
+			writeSample(w, v.name, v.labels, values, "", "", m.Value())
+		case *Gauge:
+			writeSample(w, v.name, v.labels, values, "", "", m.Value())
+		case *Histogram:
+			var cumulative uint64
+			for i, bound := range m.upperBounds {
+				cumulative += atomic.LoadUint64(&m.counts[i])
+				writeSample(w, v.name+"_bucket", v.labels, values, "le", formatFloat(bound), float64(cumulative))
+			}
+			// count is loaded after the buckets, so +Inf is never less than them
+			count := m.Count()
+			if count < cumulative {
+				count = cumulative
+			}
+			writeSample(w, v.name+"_bucket", v.labels, values, "le", "+Inf", float64(count))
+			writeSample(w, v.name+"_sum", v.labels, values, "", "", m.Sum())
+			writeSample(w, v.name+"_count", v.labels, values, "", "", float64(count))
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + labelEscaper.Replace(values[i]) + `"`)
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,67 @@
+package gee
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gee/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	r := New()
+	r.Use(Metrics(reg))
+	r.GET("/hello/:name", func(c *Context) {
+		c.String(http.StatusOK, "hello %s", c.Param("name"))
+	})
+	r.GET("/metrics", MetricsHandler(reg))
+
+	serve(r, "GET", "/hello/geektutu", nil)
+	serve(r, "GET", "/hello/jack", nil)
+	serve(r, "GET", "/nothing", nil)
+	serve(r, "FOO", "/nothing", nil)
+	serve(r, "BAR", "/nothing", nil)
+	w := serve(r, "GET", "/metrics", nil)
+	body := w.Body.String()
+
+	for _, line := range []string{
+		`gee_http_requests_total{method="GET",route="/hello/:name",code="200"} 2`,
+		`gee_http_requests_total{method="GET",route="unmatched",code="404"} 1`,
+		`gee_http_requests_total{method="OTHER",route="unmatched",code="404"} 2`,
+		`gee_http_requests_in_flight{method="GET",route="/metrics"} 1`,
+		`gee_http_request_duration_seconds_count{method="GET",route="/hello/:name"} 2`,
+		`gee_http_response_size_bytes_sum{method="GET",route="/hello/:name"} 24`,
+		`gee_http_response_size_bytes_bucket{method="GET",route="/hello/:name",le="64"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expect %s, but got\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsHostsAndRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+	r := New()
+	r.Use(Metrics(reg))
+	r.Host("api.example.com").GET("/users", func(c *Context) {
+		c.Writer.(http.Flusher).Flush()
+		c.String(http.StatusOK, "users")
+	})
+	// another engine shares the registry
+	other := New()
+	other.Use(Metrics(reg))
+	other.GET("/users", func(c *Context) {})
+
+	serveHost(r, "api.example.com", "/users", nil)
+	serve(other, "GET", "/users", nil)
+	w := serve(reg, "GET", "/metrics", nil)
+	for _, line := range []string{
+		`gee_http_requests_total{method="GET",route="api.example.com/users",code="200"} 1`,
+		`gee_http_requests_total{method="GET",route="/users",code="200"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("expect %s, but got\n%s", line, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,697 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAPIInfo is the info object of the OpenAPI spec
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPISpec is an OpenAPI 3 document
+// refer https://spec.openapis.org/oas/v3.0.3
+type OpenAPISpec struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       OpenAPIInfo          `json:"info"`
+	Servers    []server             `json:"servers,omitempty"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components *openAPIComponents   `json:"components,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*schema `json:"schemas,omitempty"`
+}
+
+type server struct {
+	URL       string                    `json:"url"`
+	Variables map[string]serverVariable `json:"variables,omitempty"`
+}
+
+type serverVariable struct {
+	Default string `json:"default"`
+}
+
+type pathItem struct {
+	Get     *operation `json:"get,omitempty"`
+	Put     *operation `json:"put,omitempty"`
+	Post    *operation `json:"post,omitempty"`
+	Delete  *operation `json:"delete,omitempty"`
+	Options *operation `json:"options,omitempty"`
+	Head    *operation `json:"head,omitempty"`
+	Patch   *operation `json:"patch,omitempty"`
+}
+
+func (p *pathItem) set(method string, op *operation) {
+	switch method {
+	case http.MethodGet:
+		p.Get = op
+	case http.MethodPut:
+		p.Put = op
+	case http.MethodPost:
+		p.Post = op
+	case http.MethodDelete:
+		p.Delete = op
+	case http.MethodOptions:
+		p.Options = op
+	case http.MethodHead:
+		p.Head = op
+	case http.MethodPatch:
+		p.Patch = op
+	}
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []parameter          `json:"parameters,omitempty"`
+	RequestBody *requestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Description string                `json:"description"`
+	Content     map[string]*mediaType `json:"content,omitempty"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// GenerateOpenAPI generates the OpenAPI spec of the routes registered on
+// the virtual host of the group, the default host for the engine. The
+// routes of other hosts may have the same paths, each host has its spec.
+func (group *RouterGroup) GenerateOpenAPI(info OpenAPIInfo) *OpenAPISpec {
+	spec := &OpenAPISpec{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   make(map[string]*pathItem),
+	}
+	if group.host != nil && group.host.pattern != "" {
+		spec.Servers = []server{hostServer(group.host)}
+	}
+	g := &schemaGenerator{
+		schemas:      make(map[string]*schema),
+		names:        make(map[reflect.Type]string),
+		operationIDs: make(map[string]bool),
+	}
+	for _, route := range group.engine.routes {
+		if route.hidden || route.host != group.host {
+			continue
+		}
+		p, params := openAPIPath(route.Pattern)
+		item, ok := spec.Paths[p]
+		if !ok {
+			item = &pathItem{}
+			spec.Paths[p] = item
+		}
+		item.set(route.Method, g.operation(route, p, params))
+	}
+	if len(g.schemas) > 0 {
+		spec.Components = &openAPIComponents{Schemas: g.schemas}
+	}
+	return spec
+}
+
+// JSON returns the spec encoded as JSON
+func (spec *OpenAPISpec) JSON() ([]byte, error) {
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// YAML returns the spec encoded as YAML
+func (spec *OpenAPISpec) YAML() ([]byte, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeYAML(&buf, v, 0)
+	return buf.Bytes(), nil
+}
+
+// ServeOpenAPI serves the spec of the routes of the group's host at relativePath/openapi.json
+// and relativePath/openapi.yaml, and a page to browse it at relativePath.
+// The spec is generated on the first request, after all routes are registered.
+func (group *RouterGroup) ServeOpenAPI(relativePath string, info OpenAPIInfo) {
+	var (
+		once     sync.Once
+		jsonSpec []byte
+		yamlSpec []byte
+		err      error
+	)
+	load := func(c *Context) bool {
+		once.Do(func() {
+			spec := group.GenerateOpenAPI(info)
+			if jsonSpec, err = spec.JSON(); err == nil {
+				yamlSpec, err = spec.YAML()
+			}
+		})
+		if err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return false
+		}
+		return true
+	}
+
+	specPath := path.Join(group.prefix, relativePath, "openapi.json")
+	group.GET(relativePath, func(c *Context) {
+		c.SetHeader("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		openAPIPage.Execute(c.Writer, map[string]string{"Title": info.Title, "Spec": specPath})
+	}).Hide()
+	group.GET(path.Join(relativePath, "openapi.json"), func(c *Context) {
+		if load(c) {
+			c.SetHeader("Content-Type", "application/json")
+			c.Data(http.StatusOK, jsonSpec)
+		}
+	}).Hide()
+	group.GET(path.Join(relativePath, "openapi.yaml"), func(c *Context) {
+		if load(c) {
+			c.SetHeader("Content-Type", "application/yaml")
+			c.Data(http.StatusOK, yamlSpec)
+		}
+	}).Hide()
+}
+
+// openAPIPath converts /users/:id/*filepath to /users/{id}/{filepath}
+func openAPIPath(pattern string) (string, []string) {
+	var params []string
+	parts := parsePattern(pattern)
+	for i, part := range parts {
+		if part[0] == ':' || part[0] == '*' {
+			name := part[1:]
+			if name == "" {
+				name = "path"
+			}
+			params = append(params, name)
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return "/" + strings.Join(parts, "/"), params
+}
+
+func hostServer(vh *virtualHost) server {
+	s := server{URL: "//" + vh.pattern}
+	for _, label := range vh.labels {
+		if isHostParam(label) {
+			if s.Variables == nil {
+				s.Variables = make(map[string]serverVariable)
+			}
+			name := label[1 : len(label)-1]
+			s.Variables[name] = serverVariable{Default: name}
+		}
+	}
+	return s
+}
+
+// operationID returns the ID of the operation of method on p, numbered
+// if another operation has it, e.g. for /a-b and /a_b
+func (g *schemaGenerator) operationID(method string, p string) string {
+	id := operationID(method, p)
+	unique := id
+	for i := 2; g.operationIDs[unique]; i++ {
+		unique = id + strconv.Itoa(i)
+	}
+	g.operationIDs[unique] = true
+	return unique
+}
+
+func operationID(method string, p string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(p, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.'
+	}) {
+		id.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return id.String()
+}
+
+// schemaGenerator reflects Go types into schemas, named structs are
+// stored as components and referenced
+type schemaGenerator struct {
+	schemas      map[string]*schema
+	names        map[reflect.Type]string
+	operationIDs map[string]bool
+}
+
+func (g *schemaGenerator) operation(route *Route, p string, params []string) *operation {
+	op := &operation{
+		OperationID: g.operationID(route.Method, p),
+		Summary:     route.summary,
+		Description: route.description,
+		Tags:        route.tags,
+		Responses:   make(map[string]*response),
+	}
+
+	var reqType reflect.Type
+	if route.request != nil {
+		reqType = indirectType(reflect.TypeOf(route.request))
+	}
+	for _, name := range params {
+		param := parameter{Name: name, In: "path", Required: true, Schema: &schema{Type: "string"}}
+		if f, ok := findField(reqType, "uri", name); ok {
+			param.Schema = g.schemaOf(f.Type)
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+
+	if reqType != nil {
+		if route.Method == http.MethodGet || route.Method == http.MethodHead || route.Method == http.MethodDelete {
+			op.Parameters = append(op.Parameters, g.queryParameters(reqType)...)
+		} else {
+			op.RequestBody = &requestBody{
+				Required: true,
+				Content:  map[string]*mediaType{"application/json": {Schema: g.schemaOf(reqType)}},
+			}
+		}
+	}
+
+	for code, obj := range route.responses {
+		res := &response{Description: http.StatusText(code)}
+		if obj != nil {
+			res.Content = map[string]*mediaType{"application/json": {Schema: g.schemaOf(reflect.TypeOf(obj))}}
+		}
+		op.Responses[strconv.Itoa(code)] = res
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = &response{Description: http.StatusText(http.StatusOK)}
+	}
+	return op
+}
+
+func (g *schemaGenerator) queryParameters(t reflect.Type) []parameter {
+	var params []parameter
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	eachField(t, func(f reflect.StructField) {
+		if _, ok := f.Tag.Lookup("uri"); ok {
+			return
+		}
+		name := fieldName(f, "form")
+		if name == "" {
+			return
+		}
+		s := g.schemaOf(f.Type)
+		required := applyBinding(s, f)
+		params = append(params, parameter{Name: name, In: "query", Required: required, Schema: s})
+	})
+	return params
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) *schema {
+	nullable := t.Kind() == reflect.Ptr
+	t = indirectType(t)
+	var s *schema
+	switch {
+	case t == timeType:
+		s = &schema{Type: "string", Format: "date-time"}
+	case t == bytesType:
+		s = &schema{Type: "string", Format: "byte"}
+	default:
+		s = g.kindSchema(t)
+	}
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (g *schemaGenerator) kindSchema(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	// interface{} and anything else accepts any value
+	return &schema{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *schema {
+	if t.Name() == "" {
+		return g.objectSchema(t)
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			name = strings.Replace(t.PkgPath(), "/", ".", -1) + "." + name
+		}
+		g.names[t] = name
+		// register before reflecting fields for recursive types
+		g.schemas[name] = &schema{}
+		*g.schemas[name] = *g.objectSchema(t)
+	}
+	return &schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: make(map[string]*schema)}
+	eachField(t, func(f reflect.StructField) {
+		name := fieldName(f, "json")
+		if name == "" {
+			return
+		}
+		fs := g.schemaOf(f.Type)
+		if applyBinding(fs, f) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	})
+	return s
+}
+
+// eachField calls fn with the exported fields of t, embedded structs are flattened
+func eachField(t reflect.Type, fn func(f reflect.StructField)) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && indirectType(f.Type).Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			eachField(indirectType(f.Type), fn)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fn(f)
+	}
+}
+
+// fieldName returns the name of f in tag, or "" if the field is skipped
+func fieldName(f reflect.StructField, tag string) string {
+	name := f.Tag.Get(tag)
+	if name == "" && tag != "json" {
+		name = f.Tag.Get("json")
+	}
+	name = strings.Split(name, ",")[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+func findField(t reflect.Type, tag string, name string) (field reflect.StructField, ok bool) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return
+	}
+	eachField(t, func(f reflect.StructField) {
+		if strings.Split(f.Tag.Get(tag), ",")[0] == name {
+			field, ok = f, true
+		}
+	})
+	return
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// applyBinding applies the validation rules in the binding tag of f to s,
+// e.g. `binding:"required,min=1,max=20,oneof=a b"`. It reports whether
+// the field is required.
+func applyBinding(s *schema, f reflect.StructField) (required bool) {
+	for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		switch kv[0] {
+		case "required":
+			required = true
+		case "min", "gte", "max", "lte", "len":
+			if len(kv) != 2 || s.Ref != "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				continue
+			}
+			if kv[0] == "min" || kv[0] == "gte" || kv[0] == "len" {
+				setBound(s, n, true)
+			}
+			if kv[0] == "max" || kv[0] == "lte" || kv[0] == "len" {
+				setBound(s, n, false)
+			}
+		case "oneof":
+			if len(kv) != 2 {
+				continue
+			}
+			for _, v := range strings.Fields(kv[1]) {
+				if n, err := strconv.ParseFloat(v, 64); err == nil && (s.Type == "integer" || s.Type == "number") {
+					s.Enum = append(s.Enum, n)
+				} else {
+					s.Enum = append(s.Enum, v)
+				}
+			}
+		}
+	}
+	return
+}
+
+func setBound(s *schema, n float64, min bool) {
+	i := int(n)
+	switch s.Type {
+	case "integer", "number":
+		if min {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	case "string":
+		if min {
+			s.MinLength = &i
+		} else {
+			s.MaxLength = &i
+		}
+	case "array":
+		if min {
+			s.MinItems = &i
+		} else {
+			s.MaxItems = &i
+		}
+	}
+}
+
+// writeYAML writes v decoded from JSON as block style YAML
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf.WriteString(pad + yamlScalar(k) + ":")
+			writeYAMLValue(buf, v[k], indent+1)
+		}
+	case []interface{}:
+		for _, item := range v {
+			buf.WriteString(pad + "-")
+			writeYAMLValue(buf, item, indent+1)
+		}
+	}
+}
+
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, value, indent)
+	case []interface{}:
+		if len(value) == 0 {
+			buf.WriteString(" []\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeYAML(buf, value, indent)
+	default:
+		buf.WriteString(" " + yamlScalar(value) + "\n")
+	}
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if yamlPlain(v) {
+			return v
+		}
+		// JSON strings are valid double-quoted YAML scalars
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// yamlPlain reports whether s can be written unquoted without being read
+// as another type, e.g. "200" or "true"
+func yamlPlain(s string) bool {
+	switch strings.ToLower(s) {
+	case "", "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return false
+	}
+	for i, r := range s {
+		isLetter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+		if i == 0 && !isLetter {
+			return false
+		}
+		if !isLetter && !(r >= '0' && r <= '9') && !strings.ContainsRune("./- ", r) {
+			return false
+		}
+	}
+	return !strings.HasSuffix(s, " ")
+}
+
+var openAPIPage = template.Must(template.New("openapi").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; color: #3b4151; }
+.op { border: 1px solid #ddd; border-radius: 4px; margin: 8px 0; }
+.op summary { padding: 8px; cursor: pointer; }
+.op .body { padding: 0 12px 12px; }
+.method { display: inline-block; width: 64px; text-align: center; color: #fff; border-radius: 3px; font-weight: bold; }
+.get { background: #61affe; } .post { background: #49cc90; } .put { background: #fca130; }
+.delete { background: #f93e3e; } .patch { background: #50e3c2; } .head, .options { background: #9012fe; }
+pre { background: #f7f7f7; padding: 8px; overflow: auto; }
+table { border-collapse: collapse; } td, th { border-bottom: 1px solid #eee; padding: 4px 12px 4px 0; text-align: left; }
+</style>
+</head>
+<body>
+<div id="app">Loading <a href="{{.Spec}}">{{.Spec}}</a> ...</div>
+<script>
+var specURL = {{.Spec}};
+fetch(specURL).then(function (res) { return res.json(); }).then(function (spec) {
+  var esc = function (s) { return String(s).replace(/[&<>"]/g, function (c) { return {"&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;"}[c]; }); };
+  var json = function (v) { return "<pre>" + esc(JSON.stringify(v, null, 2)) + "</pre>"; };
+  var groups = {};
+  Object.keys(spec.paths).sort().forEach(function (p) {
+    var item = spec.paths[p];
+    ["get", "post", "put", "patch", "delete", "head", "options"].forEach(function (m) {
+      if (!item[m]) return;
+      (item[m].tags || ["default"]).forEach(function (tag) {
+        (groups[tag] = groups[tag] || []).push({path: p, method: m, op: item[m]});
+      });
+    });
+  });
+  var html = "<h1>" + esc(spec.info.title) + " <small>" + esc(spec.info.version) + "</small></h1>";
+  if (spec.info.description) html += "<p>" + esc(spec.info.description) + "</p>";
+  if (spec.servers) html += "<p>Host: " + esc(spec.servers[0].url) + "</p>";
+  html += '<p><a href="' + esc(specURL) + '">openapi.json</a></p>';
+  Object.keys(groups).sort().forEach(function (tag) {
+    html += "<h2>" + esc(tag) + "</h2>";
+    groups[tag].forEach(function (e) {
+      html += '<details class="op"><summary><span class="method ' + e.method + '">' + e.method.toUpperCase() +
+        "</span> <b>" + esc(e.path) + "</b> " + esc(e.op.summary || "") + "</summary><div class=\"body\">";
+      if (e.op.description) html += "<p>" + esc(e.op.description) + "</p>";
+      if (e.op.parameters) {
+        html += "<h4>Parameters</h4><table><tr><th>Name</th><th>In</th><th>Schema</th></tr>";
+        e.op.parameters.forEach(function (p) {
+          html += "<tr><td>" + esc(p.name) + (p.required ? " *" : "") + "</td><td>" + esc(p.in) + "</td><td>" + esc(JSON.stringify(p.schema)) + "</td></tr>";
+        });
+        html += "</table>";
+      }
+      if (e.op.requestBody) html += "<h4>Request body</h4>" + json(e.op.requestBody.content["application/json"].schema);
+      html += "<h4>Responses</h4>";
+      Object.keys(e.op.responses).sort().forEach(function (code) {
+        var r = e.op.responses[code];
+        html += "<p><b>" + esc(code) + "</b> " + esc(r.description) + "</p>";
+        if (r.content) html += json(r.content["application/json"].schema);
+      });
+      html += "</div></details>";
+    });
+  });
+  if (spec.components && spec.components.schemas) {
+    html += "<h2>Schemas</h2>";
+    Object.keys(spec.components.schemas).sort().forEach(function (name) {
+      html += '<details class="op"><summary><b>' + esc(name) + "</b></summary><div class=\"body\">" + json(spec.components.schemas[name]) + "</div></details>";
+    });
+  }
+  document.getElementById("app").innerHTML = html;
+});
+</script>
+</body>
+</html>
+`))
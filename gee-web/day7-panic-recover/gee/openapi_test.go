@@ -0,0 +1,190 @@
+package gee
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	ID       int64       `json:"id" uri:"id"`
+	Name     string      `json:"name" binding:"required,min=1,max=20"`
+	Role     string      `json:"role,omitempty" binding:"oneof=admin guest"`
+	Friends  []*testUser `json:"friends,omitempty"`
+	Created  time.Time   `json:"created"`
+	Password string      `json:"-"`
+}
+
+type testQuery struct {
+	Page int    `form:"page" binding:"min=1"`
+	Sort string `form:"sort"`
+}
+
+func newTestOpenAPIEngine() *Engine {
+	r := New()
+	r.GET("/users", nil).Summary("List users").Tags("user").
+		Request(testQuery{}).Response(http.StatusOK, []testUser{})
+	v1 := r.Group("/v1")
+	v1.GET("/users/:id", nil).Tags("user").Request(testUser{}).Response(http.StatusOK, testUser{})
+	v1.POST("/users", nil).Summary("Create a user").Tags("user").
+		Request(&testUser{}).Response(http.StatusCreated, testUser{}).Response(http.StatusBadRequest, H{})
+	r.GET("/assets/*filepath", nil)
+	tenant := r.Host("{tenant}.example.com")
+	tenant.GET("/", nil)
+	tenant.GET("/users", nil)
+	r.ServeOpenAPI("/docs", OpenAPIInfo{Title: "Gee", Version: "1.0"})
+	return r
+}
+
+func decodeSpec(t *testing.T, r *RouterGroup) map[string]interface{} {
+	data, err := r.GenerateOpenAPI(OpenAPIInfo{Title: "Gee", Version: "1.0"}).JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func lookup(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func TestOpenAPIPaths(t *testing.T) {
+	r := newTestOpenAPIEngine()
+	spec := decodeSpec(t, r.RouterGroup)
+	paths := spec["paths"].(map[string]interface{})
+	var keys []string
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	expect := map[string]bool{"/users": true, "/v1/users/{id}": true, "/v1/users": true, "/assets/{filepath}": true}
+	if len(keys) != len(expect) {
+		t.Fatalf("expect paths %v, but got %v", expect, keys)
+	}
+	for _, k := range keys {
+		if !expect[k] {
+			t.Fatalf("unexpected path %s", k)
+		}
+	}
+
+	if _, ok := spec["servers"]; ok {
+		t.Errorf("expect no servers for the default host, but got %v", spec["servers"])
+	}
+	if v := lookup(paths, "/users", "get", "operationId"); v != "getUsers" {
+		t.Errorf("expect operationId getUsers, but got %v", v)
+	}
+
+	params := lookup(paths, "/users", "get", "parameters").([]interface{})
+	page := params[0].(map[string]interface{})
+	if page["name"] != "page" || page["in"] != "query" || lookup(page, "schema", "minimum") != 1.0 {
+		t.Errorf("expect query parameter page, but got %v", page)
+	}
+	id := lookup(paths, "/v1/users/{id}", "get", "parameters").([]interface{})[0]
+	if lookup(id, "in") != "path" || lookup(id, "schema", "type") != "integer" {
+		t.Errorf("expect integer path parameter id, but got %v", id)
+	}
+
+	if v := lookup(paths, "/v1/users", "post", "requestBody", "content", "application/json", "schema", "$ref"); v != "#/components/schemas/testUser" {
+		t.Errorf("expect request body of testUser, but got %v", v)
+	}
+	if v := lookup(paths, "/v1/users", "post", "responses", "400", "description"); v != "Bad Request" {
+		t.Errorf("expect 400 response, but got %v", v)
+	}
+}
+
+func TestOpenAPIHosts(t *testing.T) {
+	r := newTestOpenAPIEngine()
+	var tenant *RouterGroup
+	for _, group := range r.groups {
+		if group.host != nil {
+			tenant = group
+		}
+	}
+	spec := decodeSpec(t, tenant)
+	if v := spec["servers"]; !reflect.DeepEqual(v, []interface{}{map[string]interface{}{
+		"url": "//{tenant}.example.com", "variables": map[string]interface{}{"tenant": map[string]interface{}{"default": "tenant"}},
+	}}) {
+		t.Errorf("expect server of host, but got %v", v)
+	}
+	paths := spec["paths"].(map[string]interface{})
+	if len(paths) != 2 || lookup(paths, "/users", "get") == nil || lookup(paths, "/", "get") == nil {
+		t.Fatalf("expect the routes of the host only, but got %v", paths)
+	}
+	if v := lookup(paths, "/users", "get", "summary"); v != nil {
+		t.Errorf("expect the route of the host, not the default one, but got summary %v", v)
+	}
+
+	r = New()
+	r.GET("/a-b", nil)
+	r.GET("/a_b", nil)
+	paths = decodeSpec(t, r.RouterGroup)["paths"].(map[string]interface{})
+	if a, b := lookup(paths, "/a-b", "get", "operationId"), lookup(paths, "/a_b", "get", "operationId"); a != "getAB" || b != "getAB2" {
+		t.Errorf("expect unique operation IDs, but got %v and %v", a, b)
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	spec := decodeSpec(t, newTestOpenAPIEngine().RouterGroup)
+	user := lookup(spec, "components", "schemas", "testUser").(map[string]interface{})
+	if !reflect.DeepEqual(user["required"], []interface{}{"name"}) {
+		t.Errorf("expect name to be required, but got %v", user["required"])
+	}
+	props := user["properties"].(map[string]interface{})
+	if _, ok := props["Password"]; ok {
+		t.Error("expect fields with json:\"-\" to be skipped")
+	}
+	if v := lookup(props, "name", "maxLength"); v != 20.0 {
+		t.Errorf("expect maxLength 20, but got %v", v)
+	}
+	if v := lookup(props, "role", "enum"); !reflect.DeepEqual(v, []interface{}{"admin", "guest"}) {
+		t.Errorf("expect enum of role, but got %v", v)
+	}
+	if v := lookup(props, "created", "format"); v != "date-time" {
+		t.Errorf("expect date-time, but got %v", v)
+	}
+	if v := lookup(props, "friends", "items", "$ref"); v != "#/components/schemas/testUser" {
+		t.Errorf("expect recursive reference, but got %v", v)
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	r := newTestOpenAPIEngine()
+	w := serve(r, "GET", "/docs/openapi.json", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"openapi": "3.0.3"`) {
+		t.Fatalf("expect openapi.json, but got %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "/docs") {
+		t.Fatal("expect routes of the spec to be hidden")
+	}
+	w = serve(r, "GET", "/docs/openapi.yaml", nil)
+	if !strings.Contains(w.Body.String(), "openapi: \"3.0.3\"\n") || !strings.Contains(w.Body.String(), `"$ref": "#/components/schemas/testUser"`) {
+		t.Fatalf("expect openapi.yaml, but got %s", w.Body.String())
+	}
+	w = serve(r, "GET", "/docs", nil)
+	if !strings.Contains(w.Body.String(), `var specURL = "/docs/openapi.json";`) {
+		t.Fatalf("expect page to load the spec, but got %s", w.Body.String())
+	}
+
+	// the path of the spec is escaped in the page
+	r = New()
+	r.ServeOpenAPI(`/docs"<b>`, OpenAPIInfo{Title: "Gee", Version: "1.0"})
+	w = serve(r, "GET", "/docs%22%3Cb%3E", nil)
+	if body := w.Body.String(); w.Code != http.StatusOK || strings.Contains(body, `"<b>`) ||
+		!strings.Contains(body, `href="/docs%22%3cb%3e/openapi.json"`) ||
+		!strings.Contains(body, `var specURL = "/docs\"\u003cb\u003e/openapi.json";`) {
+		t.Fatalf("expect the spec path to be escaped, but got %d %s", w.Code, body)
+	}
+}
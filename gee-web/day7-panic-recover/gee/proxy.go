@@ -0,0 +1,425 @@
+package gee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer selects the upstream of a proxied request
+type Balancer int
+
+const (
+	// RoundRobin sends requests to the available upstreams in turn
+	RoundRobin Balancer = iota
+	// LeastConn sends requests to the upstream with the fewest active requests
+	LeastConn
+)
+
+// ProxyOptions configures a Gateway, the zero value is usable
+type ProxyOptions struct {
+	Balancer Balancer
+	// StripPrefix is removed from the request path before proxying
+	StripPrefix string
+	// SetHeaders and RemoveHeaders rewrite the request headers
+	SetHeaders    map[string]string
+	RemoveHeaders []string
+	// ResponseHeaders are set on the responses of the upstreams
+	ResponseHeaders map[string]string
+	// Retries is the number of other upstreams to try when an idempotent
+	// request fails with an error or a 502, 503 or 504 response
+	Retries int
+	// HealthCheckPath is requested on every upstream each
+	// HealthCheckInterval, upstreams not responding 2xx or 3xx are skipped.
+	// Health checks are disabled when HealthCheckInterval is zero.
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	// FailureThreshold consecutive failures open the circuit of an upstream
+	// for OpenTimeout, after which a single trial request is let through.
+	// Defaults are 5 and 30s.
+	FailureThreshold int
+	OpenTimeout      time.Duration
+	// Transport is used to reach the upstreams, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+var errNoUpstream = errors.New("gee: no upstream available")
+
+// circuit breaker states
+const (
+	circuitClosed = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type upstream struct {
+	url     *url.URL
+	active  int64 // requests in flight, accessed atomically
+	healthy int32 // 1 if the last health check passed, accessed atomically
+
+	mu        sync.Mutex
+	state     int
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial request is in flight
+}
+
+// Gateway is a reverse proxy balancing requests across upstreams
+type Gateway struct {
+	opts      ProxyOptions
+	upstreams []*upstream
+	next      uint32
+	proxy     *httputil.ReverseProxy
+	now       func() time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewGateway is the constructor of Gateway, targets are the base URLs of the
+// upstreams. Call Close to stop the health checks.
+func NewGateway(targets []string, opts *ProxyOptions) (*Gateway, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("gee: proxy needs at least one target")
+	}
+	g := &Gateway{now: time.Now, done: make(chan struct{})}
+	if opts != nil {
+		g.opts = *opts
+	}
+	if g.opts.FailureThreshold <= 0 {
+		g.opts.FailureThreshold = 5
+	}
+	if g.opts.OpenTimeout <= 0 {
+		g.opts.OpenTimeout = 30 * time.Second
+	}
+	if g.opts.HealthCheckTimeout <= 0 {
+		g.opts.HealthCheckTimeout = 5 * time.Second
+	}
+	if g.opts.Transport == nil {
+		g.opts.Transport = http.DefaultTransport
+	}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("gee: invalid proxy target %q: %v", target, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("gee: invalid proxy target %q: missing scheme or host", target)
+		}
+		g.upstreams = append(g.upstreams, &upstream{url: u, healthy: 1})
+	}
+	g.proxy = &httputil.ReverseProxy{
+		Director:       g.director,
+		Transport:      (*gatewayTransport)(g),
+		ModifyResponse: g.modifyResponse,
+		ErrorHandler:   g.errorHandler,
+	}
+	if g.opts.HealthCheckInterval > 0 {
+		go g.healthCheckLoop()
+	}
+	return g, nil
+}
+
+// Proxy returns a handler proxying requests to targets, it panics if a
+// target is invalid. Its health checks run as long as the program, use
+// NewGateway and Close to stop them. Mount it on a wildcard route, e.g.
+//
+//	api := r.Group("/api")
+//	api.Any("/*path", gee.Proxy([]string{"http://10.0.0.1", "http://10.0.0.2"},
+//		&gee.ProxyOptions{StripPrefix: "/api", Balancer: gee.LeastConn}))
+func Proxy(targets []string, opts *ProxyOptions) HandlerFunc {
+	g, err := NewGateway(targets, opts)
+	if err != nil {
+		panic(err)
+	}
+	return g.Handler()
+}
+
+// Handler returns the handler proxying requests
+func (g *Gateway) Handler() HandlerFunc {
+	return func(c *Context) {
+		g.proxy.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	g.proxy.ServeHTTP(w, req)
+}
+
+// Close stops the health checks
+func (g *Gateway) Close() {
+	g.closeOnce.Do(func() { close(g.done) })
+}
+
+func (g *Gateway) director(req *http.Request) {
+	if prefix := strings.TrimSuffix(g.opts.StripPrefix, "/"); prefix != "" {
+		if req.URL.Path == prefix || strings.HasPrefix(req.URL.Path, prefix+"/") {
+			// strip the escaped path too, so that an encoded "/" stays encoded
+			rawPath, rawPrefix := req.URL.EscapedPath(), (&url.URL{Path: prefix}).EscapedPath()
+			req.URL.Path = req.URL.Path[len(prefix):]
+			req.URL.RawPath = ""
+			if strings.HasPrefix(rawPath, rawPrefix) {
+				req.URL.RawPath = rawPath[len(rawPrefix):]
+			}
+		}
+		if req.URL.Path == "" {
+			req.URL.Path, req.URL.RawPath = "/", ""
+		}
+	}
+	for _, key := range g.opts.RemoveHeaders {
+		req.Header.Del(key)
+	}
+	for key, value := range g.opts.SetHeaders {
+		req.Header.Set(key, value)
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// explicitly disable the default User-Agent of the client
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+func (g *Gateway) modifyResponse(res *http.Response) error {
+	for key, value := range g.opts.ResponseHeaders {
+		res.Header.Set(key, value)
+	}
+	return nil
+}
+
+func (g *Gateway) errorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	code := http.StatusBadGateway
+	if err == errNoUpstream {
+		code = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(code)
+}
+
+// pick selects an available upstream not in tried, nil if there is none
+func (g *Gateway) pick(tried map[*upstream]bool) *upstream {
+	n := len(g.upstreams)
+	start := int(atomic.AddUint32(&g.next, 1) - 1)
+	var best *upstream
+	for i := 0; i < n; i++ {
+		u := g.upstreams[(start+i)%n]
+		if tried[u] || atomic.LoadInt32(&u.healthy) == 0 || !g.ready(u) {
+			continue
+		}
+		if g.opts.Balancer == RoundRobin {
+			best = u
+			break
+		}
+		if best == nil || atomic.LoadInt64(&u.active) < atomic.LoadInt64(&best.active) {
+			best = u
+		}
+	}
+	if best != nil && !g.allow(best) {
+		// another request took the half-open trial in the meantime
+		tried[best] = true
+		return g.pick(tried)
+	}
+	return best
+}
+
+// ready reports whether the circuit of u would let a request through
+func (g *Gateway) ready(u *upstream) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch u.state {
+	case circuitOpen:
+		return !g.now().Before(u.openUntil)
+	case circuitHalfOpen:
+		return !u.trial
+	}
+	return true
+}
+
+// allow lets a request through the circuit of u
+func (g *Gateway) allow(u *upstream) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch u.state {
+	case circuitOpen:
+		if g.now().Before(u.openUntil) {
+			return false
+		}
+		u.state = circuitHalfOpen
+		u.trial = true
+	case circuitHalfOpen:
+		if u.trial {
+			return false
+		}
+		u.trial = true
+	}
+	return true
+}
+
+// release ends a request to u without a result, letting another trial
+// request through if it was the trial
+func (g *Gateway) release(u *upstream) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.trial = false
+}
+
+// report records the result of a request to u
+func (g *Gateway) report(u *upstream, ok bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.trial = false
+	if ok {
+		u.state = circuitClosed
+		u.failures = 0
+		return
+	}
+	u.failures++
+	if u.state == circuitHalfOpen || u.failures >= g.opts.FailureThreshold {
+		u.state = circuitOpen
+		u.openUntil = g.now().Add(g.opts.OpenTimeout)
+	}
+}
+
+func (g *Gateway) healthCheckLoop() {
+	ticker := time.NewTicker(g.opts.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.done:
+			return
+		case <-ticker.C:
+			g.healthCheck()
+		}
+	}
+}
+
+func (g *Gateway) healthCheck() {
+	client := &http.Client{Transport: g.opts.Transport, Timeout: g.opts.HealthCheckTimeout}
+	var wg sync.WaitGroup
+	for _, u := range g.upstreams {
+		wg.Add(1)
+		go func(u *upstream) {
+			defer wg.Done()
+			var healthy int32
+			res, err := client.Get(joinURL(u.url, &url.URL{Path: g.opts.HealthCheckPath}).String())
+			if err == nil {
+				io.Copy(ioutil.Discard, res.Body)
+				res.Body.Close()
+				if res.StatusCode < 400 {
+					healthy = 1
+				}
+			}
+			atomic.StoreInt32(&u.healthy, healthy)
+		}(u)
+	}
+	wg.Wait()
+}
+
+// joinURL returns the URL of ref on the upstream base, joining the
+// escaped paths as well so that an encoded "/" stays encoded
+func joinURL(base *url.URL, ref *url.URL) *url.URL {
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + "/" + strings.TrimPrefix(ref.Path, "/")
+	u.RawPath = ""
+	if base.RawPath != "" || ref.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + "/" + strings.TrimPrefix(ref.EscapedPath(), "/")
+	}
+	switch {
+	case base.RawQuery == "":
+		u.RawQuery = ref.RawQuery
+	case ref.RawQuery != "":
+		u.RawQuery = base.RawQuery + "&" + ref.RawQuery
+	}
+	return &u
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isUpstreamFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// gatewayTransport sends a request to an upstream picked by the gateway,
+// retrying on other upstreams when allowed
+type gatewayTransport Gateway
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	g := (*Gateway)(t)
+	attempts := 1
+	// a request body can't be replayed
+	if isIdempotent(req.Method) && (req.Body == nil || req.Body == http.NoBody) {
+		attempts += g.opts.Retries
+	}
+	tried := make(map[*upstream]bool)
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		u := g.pick(tried)
+		if u == nil {
+			break
+		}
+		tried[u] = true
+
+		out := req.Clone(req.Context())
+		out.URL = joinURL(u.url, req.URL)
+		out.Host = u.url.Host
+		atomic.AddInt64(&u.active, 1)
+		res, err := g.opts.Transport.RoundTrip(out)
+		failed := isUpstreamFailure(res, err)
+		if err != nil && req.Context().Err() != nil {
+			// the client went away, that says nothing about the upstream
+			g.release(u)
+			atomic.AddInt64(&u.active, -1)
+			return nil, err
+		}
+		g.report(u, !failed)
+		if err != nil {
+			atomic.AddInt64(&u.active, -1)
+			lastErr = err
+			continue
+		}
+		if failed && i < attempts-1 && req.Context().Err() == nil {
+			atomic.AddInt64(&u.active, -1)
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+			lastErr = fmt.Errorf("gee: upstream %s responded %s", u.url.Host, res.Status)
+			continue
+		}
+		res.Body = &activeBody{ReadCloser: res.Body, active: &u.active}
+		return res, nil
+	}
+	if lastErr == nil {
+		lastErr = errNoUpstream
+	}
+	return nil, lastErr
+}
+
+// activeBody counts the request as active until its response body is closed
+type activeBody struct {
+	io.ReadCloser
+	active *int64
+	once   sync.Once
+}
+
+func (b *activeBody) Close() error {
+	b.once.Do(func() { atomic.AddInt64(b.active, -1) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,217 @@
+package gee
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newUpstream starts an upstream responding its name and the proxied path
+func newUpstream(name string, code *int32) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if code != nil && atomic.LoadInt32(code) != http.StatusOK {
+			w.WriteHeader(int(atomic.LoadInt32(code)))
+			return
+		}
+		w.Header().Set("X-Upstream", name)
+		fmt.Fprintf(w, "%s %s %s %s", name, req.URL.RequestURI(), req.Header.Get("X-Gateway"), req.Header.Get("Cookie"))
+	}))
+	return s
+}
+
+func newTestGateway(t *testing.T, targets []string, opts *ProxyOptions) *Engine {
+	g, err := NewGateway(targets, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New()
+	r.Group("/api").Any("/*path", g.Handler())
+	return r
+}
+
+func TestProxyRoundRobin(t *testing.T) {
+	a, b := newUpstream("a", nil), newUpstream("b", nil)
+	defer a.Close()
+	defer b.Close()
+	r := newTestGateway(t, []string{a.URL, b.URL + "/base"}, &ProxyOptions{
+		StripPrefix:     "/api",
+		SetHeaders:      map[string]string{"X-Gateway": "gee"},
+		RemoveHeaders:   []string{"Cookie"},
+		ResponseHeaders: map[string]string{"X-Proxied": "1"},
+	})
+
+	header := http.Header{"Cookie": {"session=1"}}
+	expect := []string{"a /users?page=2 gee ", "b /base/users?page=2 gee ", "a /users?page=2 gee "}
+	for _, body := range expect {
+		w := serve(r, "GET", "/api/users?page=2", header)
+		if w.Code != http.StatusOK || w.Body.String() != body || w.Header().Get("X-Proxied") != "1" {
+			t.Fatalf("expect %q, but got %d %q", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestProxyEscapedPath(t *testing.T) {
+	a := newUpstream("a", nil)
+	defer a.Close()
+	r := newTestGateway(t, []string{a.URL + "/base"}, &ProxyOptions{StripPrefix: "/api"})
+	w := serve(r, "GET", "/api/a%2Fb", nil)
+	if expect := "a /base/a%2Fb  "; w.Body.String() != expect {
+		t.Fatalf("expect %q, but got %d %q", expect, w.Code, w.Body.String())
+	}
+}
+
+func TestProxyLeastConn(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+		fmt.Fprint(w, "slow")
+	}))
+	defer slow.Close()
+	fast := newUpstream("fast", nil)
+	defer fast.Close()
+	g, err := NewGateway([]string{slow.URL, fast.URL}, &ProxyOptions{Balancer: LeastConn})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		close(done)
+	}()
+	for atomic.LoadInt64(&g.upstreams[0].active) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Header().Get("X-Upstream") != "fast" {
+			t.Fatalf("expect busy upstream to be skipped, but got %q", w.Body.String())
+		}
+	}
+	close(release)
+	<-done
+	if n := atomic.LoadInt64(&g.upstreams[0].active); n != 0 {
+		t.Fatalf("expect no active request, but got %d", n)
+	}
+}
+
+func TestProxyRetries(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := newUpstream("up", nil)
+	defer up.Close()
+	r := newTestGateway(t, []string{down.URL, up.URL}, &ProxyOptions{Retries: 1})
+
+	for i := 0; i < 4; i++ {
+		if w := serve(r, "GET", "/api/users", nil); w.Code != http.StatusOK {
+			t.Fatalf("expect GET to be retried, but got %d", w.Code)
+		}
+	}
+
+	r = newTestGateway(t, []string{down.URL}, &ProxyOptions{Retries: 1})
+	if w := serve(r, "POST", "/api/users", nil); w.Code != http.StatusBadGateway {
+		t.Fatalf("expect 502, but got %d", w.Code)
+	}
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	code := int32(http.StatusServiceUnavailable)
+	flaky := newUpstream("flaky", &code)
+	defer flaky.Close()
+	g, err := NewGateway([]string{flaky.URL}, &ProxyOptions{FailureThreshold: 2, OpenTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	for _, expect := range []int{503, 503, 503} {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != expect {
+			t.Fatalf("expect %d, but got %d", expect, w.Code)
+		}
+	}
+	if g.upstreams[0].state != circuitOpen {
+		t.Fatal("expect circuit to be open")
+	}
+
+	// the trial request after OpenTimeout closes the circuit
+	atomic.StoreInt32(&code, http.StatusOK)
+	now = now.Add(time.Minute)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || g.upstreams[0].state != circuitClosed {
+		t.Fatalf("expect circuit to be closed, but got %d", w.Code)
+	}
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	code := int32(http.StatusInternalServerError)
+	sick := newUpstream("sick", &code)
+	defer sick.Close()
+	well := newUpstream("well", nil)
+	defer well.Close()
+	g, err := NewGateway([]string{sick.URL, well.URL}, &ProxyOptions{HealthCheckPath: "/health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.healthCheck()
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Header().Get("X-Upstream") != "well" {
+			t.Fatalf("expect unhealthy upstream to be skipped, but got %q", w.Body.String())
+		}
+	}
+
+	atomic.StoreInt32(&code, http.StatusOK)
+	g.healthCheck()
+	if atomic.LoadInt32(&g.upstreams[0].healthy) != 1 {
+		t.Fatal("expect upstream to recover")
+	}
+}
+
+func TestNewGatewayInvalidTarget(t *testing.T) {
+	if _, err := NewGateway([]string{"localhost:9999"}, nil); err == nil {
+		t.Fatal("expect error for target without scheme")
+	}
+}
+
+func TestProxyClientCancel(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	g, err := NewGateway([]string{slow.URL}, &ProxyOptions{FailureThreshold: 1, OpenTimeout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	if u := g.upstreams[0]; u.state != circuitClosed || u.failures != 0 || atomic.LoadInt64(&u.active) != 0 {
+		t.Fatalf("expect a client going away not to count as a failure, but got state %d failures %d", u.state, u.failures)
+	}
+}
+
+func TestAnyRoutes(t *testing.T) {
+	r := New()
+	routes := r.Any("/any", func(c *Context) {})
+	if len(routes) != len(anyMethods) || routes[0].Method != http.MethodGet || routes[0].Pattern != "/any" {
+		t.Fatalf("expect a route per method, but got %v", routes)
+	}
+}
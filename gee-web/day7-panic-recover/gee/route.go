@@ -0,0 +1,60 @@
+package gee
+
+// Route is a registered route. Its optional metadata documents the route
+// in the generated OpenAPI spec, e.g.
+//
+//	r.POST("/users", createUser).Summary("Create a user").Tags("user").
+//		Request(User{}).Response(http.StatusCreated, User{})
+type Route struct {
+	Method  string
+	Pattern string
+	host    *virtualHost
+
+	summary     string
+	description string
+	tags        []string
+	request     interface{}
+	responses   map[int]interface{}
+	hidden      bool
+}
+
+// Summary sets a short summary of the route
+func (r *Route) Summary(summary string) *Route {
+	r.summary = summary
+	return r
+}
+
+// Description sets a verbose explanation of the route
+func (r *Route) Description(description string) *Route {
+	r.description = description
+	return r
+}
+
+// Tags adds tags to group the route
+func (r *Route) Tags(tags ...string) *Route {
+	r.tags = append(r.tags, tags...)
+	return r
+}
+
+// Request sets the type of the request, obj is a value of the type. For
+// GET requests its fields are query parameters, otherwise it's a JSON body.
+func (r *Route) Request(obj interface{}) *Route {
+	r.request = obj
+	return r
+}
+
+// Response sets the type of the JSON response with status code,
+// obj is a value of the type or nil for an empty response
+func (r *Route) Response(code int, obj interface{}) *Route {
+	if r.responses == nil {
+		r.responses = make(map[int]interface{})
+	}
+	r.responses[code] = obj
+	return r
+}
+
+// Hide excludes the route from the OpenAPI spec
+func (r *Route) Hide() *Route {
+	r.hidden = true
+	return r
+}
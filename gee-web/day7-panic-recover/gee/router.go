@@ -2,12 +2,15 @@ package gee
 
 import (
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
 )
 
 type router struct {
 	roots    map[string]*node
 	handlers map[string]HandlerFunc
+	host     string // virtual host of the router, empty for the default host
 }
 
 func newRouter() *router {
@@ -33,7 +36,9 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
+// addRoute registers handler for pattern, slash tells whether patterns
+// differing only in the trailing slash must be distinct
+func (r *router) addRoute(method string, pattern string, handler HandlerFunc, slash bool) {
 	parts := parsePattern(pattern)
 
 	key := method + "-" + pattern
@@ -41,11 +46,16 @@ func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
 	if !ok {
 		r.roots[method] = &node{}
 	}
-	r.roots[method].insert(pattern, parts, 0)
+	r.roots[method].insert(pattern, parts, 0, slash)
 	r.handlers[key] = handler
 }
 
 func (r *router) getRoute(method string, path string) (*node, map[string]string) {
+	return r.searchRoute(method, path, false)
+}
+
+// searchRoute is getRoute matching static parts case-insensitively if fold
+func (r *router) searchRoute(method string, path string, fold bool) (*node, map[string]string) {
 	searchParts := parsePattern(path)
 	params := make(map[string]string)
 	root, ok := r.roots[method]
@@ -54,7 +64,7 @@ func (r *router) getRoute(method string, path string) (*node, map[string]string)
 		return nil, nil
 	}
 
-	n := root.search(searchParts, 0)
+	n := root.search(searchParts, 0, fold)
 
 	if n != nil {
 		parts := parsePattern(n.pattern)
@@ -84,11 +94,33 @@ func (r *router) getRoutes(method string) []*node {
 }
 
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
+	e := c.engine
+	if e == nil {
+		e = &Engine{}
+	}
+	n, params := r.searchRoute(c.Method, c.Path, e.CaseInsensitive)
 
-	if n != nil {
+	if to := r.redirectPath(e, c.Method, c.Path, n); to != "" {
+		c.handlers = append(c.handlers, func(c *Context) {
+			redirect(c, to)
+		})
+	} else if n != nil {
+		if e.UnescapePathValues && e.useRawPath(c.Req) {
+			for k, v := range params {
+				if s, err := url.PathUnescape(v); err == nil {
+					params[k] = s
+				}
+			}
+		}
 		key := c.Method + "-" + n.pattern
-		c.Params = params
+		c.fullPath = n.pattern
+		c.routeHost = r.host
+		if c.Params == nil {
+			c.Params = params
+		}
+		for k, v := range params {
+			c.Params[k] = v
+		}
 		c.handlers = append(c.handlers, r.handlers[key])
 	} else {
 		c.handlers = append(c.handlers, func(c *Context) {
@@ -97,3 +129,94 @@ func (r *router) handle(c *Context) {
 	}
 	c.Next()
 }
+
+// redirectPath returns the canonical path of the route matching path as
+// configured by the engine, or "" if there's no need to redirect
+func (r *router) redirectPath(e *Engine, method string, p string, n *node) string {
+	if e.RedirectTrailingSlash && n != nil && len(p) > 1 && !strings.Contains(n.pattern, "*") {
+		want := len(n.pattern) > 1 && strings.HasSuffix(n.pattern, "/")
+		if has := strings.HasSuffix(p, "/"); has && !want {
+			return strings.TrimSuffix(p, "/")
+		} else if !has && want {
+			return p + "/"
+		}
+	}
+	if !e.RedirectFixedPath {
+		return ""
+	}
+	clean := cleanPath(p)
+	if n != nil && clean == p {
+		return ""
+	}
+	// the fixed path takes the case of the pattern
+	n, _ = r.searchRoute(method, clean, true)
+	if n == nil {
+		return ""
+	}
+	searchParts := parsePattern(clean)
+	var b strings.Builder
+	for i, part := range parsePattern(n.pattern) {
+		switch part[0] {
+		case ':':
+			part = searchParts[i]
+		case '*':
+			part = strings.Join(searchParts[i:], "/")
+		}
+		b.WriteString("/" + part)
+	}
+	to := b.String()
+	trailing := strings.HasSuffix(clean, "/")
+	if e.RedirectTrailingSlash && !strings.Contains(n.pattern, "*") {
+		trailing = strings.HasSuffix(n.pattern, "/")
+	}
+	if to == "" || trailing {
+		to += "/"
+	}
+	if to == p {
+		return ""
+	}
+	return to
+}
+
+// cleanPath is path.Clean keeping the trailing slash
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// redirect permanently, GET requests are redirected with 301 and others
+// with 308 so that the method and body are kept
+func redirect(c *Context, to string) {
+	code := http.StatusMovedPermanently
+	if c.Method != http.MethodGet {
+		code = http.StatusPermanentRedirect
+	}
+	// a path starting with // or /\ would be taken by clients as the
+	// URL of another host
+	to = "/" + strings.TrimLeft(to, "/\\")
+	// the path matched is unescaped unless it's the raw path, an encoded
+	// "?" or "/" in it must stay encoded
+	if c.engine == nil || !c.engine.useRawPath(c.Req) {
+		to = escapePath(to)
+	}
+	if c.Req.URL.RawQuery != "" {
+		to += "?" + c.Req.URL.RawQuery
+	}
+	c.SetHeader("Location", to)
+	c.Status(code)
+}
+
+// escapePath escapes each segment of path p
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
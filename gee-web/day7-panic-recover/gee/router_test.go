@@ -2,17 +2,18 @@ package gee
 
 import (
 	"fmt"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 )
 
 func newTestRouter() *router {
 	r := newRouter()
-	r.addRoute("GET", "/", nil)
-	r.addRoute("GET", "/hello/:name", nil)
-	r.addRoute("GET", "/hello/b/c", nil)
-	r.addRoute("GET", "/hi/:name", nil)
-	r.addRoute("GET", "/assets/*filepath", nil)
+	r.addRoute("GET", "/", nil, false)
+	r.addRoute("GET", "/hello/:name", nil, false)
+	r.addRoute("GET", "/hello/b/c", nil, false)
+	r.addRoute("GET", "/hi/:name", nil, false)
+	r.addRoute("GET", "/assets/*filepath", nil, false)
 	return r
 }
 
@@ -72,3 +73,191 @@ func TestGetRoutes(t *testing.T) {
 		t.Fatal("the number of routes shoule be 4")
 	}
 }
+
+func newTestPathEngine() *Engine {
+	r := New()
+	r.GET("/hello/:name", func(c *Context) {
+		c.String(200, "hello %s", c.Param("name"))
+	})
+	r.GET("/Users/", func(c *Context) {
+		c.String(200, "users")
+	})
+	r.POST("/users/:id", func(c *Context) {
+		c.String(200, "user %s", c.Param("id"))
+	})
+	return r
+}
+
+func TestPathDefaults(t *testing.T) {
+	r := newTestPathEngine()
+	for _, p := range []string{"/hello/geektutu", "/hello/geektutu/", "//hello/geektutu"} {
+		if w := serve(r, "GET", p, nil); w.Code != 200 || w.Body.String() != "hello geektutu" {
+			t.Fatalf("expect %s to match, but got %d", p, w.Code)
+		}
+	}
+	if w := serve(r, "GET", "/users/", nil); w.Code != 404 {
+		t.Fatalf("expect case-sensitive match, but got %d", w.Code)
+	}
+}
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	r := newTestPathEngine()
+	r.RedirectTrailingSlash = true
+	tests := []struct {
+		method, path, location string
+		code                   int
+	}{
+		{"GET", "/hello/geektutu/?lang=go", "/hello/geektutu?lang=go", 301},
+		{"GET", "/Users", "/Users/", 301},
+		{"POST", "/users/1/", "/users/1", 308},
+		{"GET", "/hello/geektutu", "", 200},
+	}
+	for _, tt := range tests {
+		w := serve(r, tt.method, tt.path, nil)
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("%s %s: expect %d %q, but got %d %q", tt.method, tt.path, tt.code, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirectFixedPath(t *testing.T) {
+	r := newTestPathEngine()
+	r.RedirectFixedPath = true
+	tests := []struct {
+		path, location string
+		code           int
+	}{
+		{"/HELLO/Geektutu", "/hello/Geektutu", 301},
+		{"//hello/../hello/./geektutu/", "/hello/geektutu/", 301},
+		{"/users", "/Users", 301},
+		{"/hello/geektutu", "", 200},
+		{"/nothing/../here", "", 404},
+	}
+	for _, tt := range tests {
+		w := serve(r, "GET", tt.path, nil)
+		if w.Code != tt.code || w.Header().Get("Location") != tt.location {
+			t.Errorf("GET %s: expect %d %q, but got %d %q", tt.path, tt.code, tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	r.RedirectTrailingSlash = true
+	if w := serve(r, "GET", "/users", nil); w.Header().Get("Location") != "/Users/" {
+		t.Errorf("expect redirect to /Users/, but got %q", w.Header().Get("Location"))
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	r := newTestPathEngine()
+	r.CaseInsensitive = true
+	v1 := r.Group("/v1")
+	v1.Use(func(c *Context) {
+		c.SetHeader("X-Group", "v1")
+	})
+	v1.GET("/ping", func(c *Context) {
+		c.String(200, "pong")
+	})
+	if w := serve(r, "GET", "/HELLO/Geektutu", nil); w.Code != 200 || w.Body.String() != "hello Geektutu" {
+		t.Fatalf("expect to match ignoring case, but got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(r, "GET", "/V1/PING", nil); w.Code != 200 || w.Header().Get("X-Group") != "v1" {
+		t.Fatalf("expect middlewares of the group, but got %d %q", w.Code, w.Header().Get("X-Group"))
+	}
+}
+
+func TestUseRawPath(t *testing.T) {
+	r := newTestPathEngine()
+	if w := serve(r, "GET", "/hello/a%2Fb", nil); w.Code != 404 {
+		t.Fatalf("expect the decoded / to split the path, but got %d", w.Code)
+	}
+	r.UseRawPath = true
+	if w := serve(r, "GET", "/hello/a%2Fb", nil); w.Body.String() != "hello a%2Fb" {
+		t.Fatalf("expect escaped param, but got %q", w.Body.String())
+	}
+	r.UnescapePathValues = true
+	if w := serve(r, "GET", "/hello/a%2Fb", nil); w.Body.String() != "hello a/b" {
+		t.Fatalf("expect unescaped param, but got %q", w.Body.String())
+	}
+}
+
+func TestRedirectOtherHost(t *testing.T) {
+	r := New()
+	r.RedirectTrailingSlash = true
+	r.GET("/:name", func(c *Context) {})
+	r.GET("/users/:name/", func(c *Context) {})
+	tests := []struct {
+		path, location string
+	}{
+		{"//evil.com/", "/evil.com"},
+		{"/\\evil.com/", "/evil.com"},
+		{"//users/evil.com", "/users/evil.com/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.URL.Path = tt.path
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if location := w.Header().Get("Location"); location != tt.location {
+			t.Errorf("GET %s: expect Location %q, but got %d %q", tt.path, tt.location, w.Code, location)
+		}
+	}
+}
+
+func TestRouteConflict(t *testing.T) {
+	for _, patterns := range [][2]string{{"/foo", "/foo/"}, {"/:id", "/about/"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expect %s to conflict with %s", patterns[1], patterns[0])
+				}
+			}()
+			r := New()
+			r.RedirectTrailingSlash = true
+			r.GET(patterns[0], func(c *Context) {})
+			r.GET(patterns[1], func(c *Context) {})
+		}()
+	}
+	// the same pattern may be registered for several methods
+	r := New()
+	r.RedirectTrailingSlash = true
+	r.GET("/foo", func(c *Context) {})
+	r.POST("/foo", func(c *Context) {})
+}
+
+func TestRouteSharedNode(t *testing.T) {
+	r := New()
+	r.GET("/:id", func(c *Context) {})
+	r.GET("/about", func(c *Context) {
+		c.String(200, "about")
+	})
+	if w := serve(r, "GET", "/about", nil); w.Code != 200 || w.Body.String() != "about" {
+		t.Fatalf("expect /about to match, but got %d %q", w.Code, w.Body.String())
+	}
+	r = New()
+	r.GET("/foo", func(c *Context) {})
+	r.GET("/foo/", func(c *Context) {})
+}
+
+func TestRedirectEscaped(t *testing.T) {
+	r := New()
+	r.RedirectTrailingSlash = true
+	r.RedirectFixedPath = true
+	r.GET("/files/:name", func(c *Context) {})
+	tests := []struct {
+		target, location string
+	}{
+		{"/files/a%3Fb/", "/files/a%3Fb"},
+		{"/files/a%23b/", "/files/a%23b"},
+		{"/FILES/a%20b", "/files/a%20b"},
+	}
+	for _, tt := range tests {
+		w := serve(r, "GET", tt.target, nil)
+		if location := w.Header().Get("Location"); location != tt.location {
+			t.Errorf("GET %s: expect Location %q, but got %d %q", tt.target, tt.location, w.Code, location)
+		}
+	}
+
+	r.UseRawPath = true
+	if w := serve(r, "GET", "/files/a%2Fb/", nil); w.Header().Get("Location") != "/files/a%2Fb" {
+		t.Errorf("expect the raw path to be kept, but got %q", w.Header().Get("Location"))
+	}
+}
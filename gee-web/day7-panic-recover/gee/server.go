@@ -0,0 +1,99 @@
+package gee
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newServer creates the http.Server of the engine. HTTP/2 is served over
+// TLS, and over cleartext if UseH2C is set, which needs Go 1.24.
+func (engine *Engine) newServer(addr string) (*http.Server, error) {
+	srv := &http.Server{Addr: addr, Handler: engine}
+	if err := engine.setProtocols(srv); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// RunListener serves http requests accepted by ln
+func (engine *Engine) RunListener(ln net.Listener) error {
+	srv, err := engine.newServer(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// RunTLS starts a https server, HTTP/2 is negotiated through ALPN
+func (engine *Engine) RunTLS(addr string, certFile string, keyFile string) error {
+	srv, err := engine.newServer(addr)
+	if err != nil {
+		return err
+	}
+	return srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// RunTLSListener serves https requests accepted by ln, config must hold
+// the certificates, e.g. one returned by SelfSignedCert
+func (engine *Engine) RunTLSListener(ln net.Listener, config *tls.Config) error {
+	srv, err := engine.newServer(ln.Addr().String())
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = config
+	return srv.ServeTLS(ln, "", "")
+}
+
+// SelfSignedCert generates an in-memory certificate for development,
+// valid for a year for the given host names and IPs, "localhost",
+// "127.0.0.1" and "::1" by default
+func SelfSignedCert(hosts ...string) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"gee development"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
@@ -0,0 +1,16 @@
+//go:build go1.24
+// +build go1.24
+
+package gee
+
+import "net/http"
+
+// setProtocols serves HTTP/1 and HTTP/2 over TLS, and HTTP/2 over
+// cleartext with prior knowledge if UseH2C is set
+func (engine *Engine) setProtocols(srv *http.Server) error {
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetHTTP2(true)
+	srv.Protocols.SetUnencryptedHTTP2(engine.UseH2C)
+	return nil
+}
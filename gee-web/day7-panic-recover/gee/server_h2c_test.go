@@ -0,0 +1,39 @@
+//go:build go1.24
+// +build go1.24
+
+package gee
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRunH2C(t *testing.T) {
+	r := newTestProtoEngine()
+	r.UseH2C = true
+	ln := listen(t)
+	defer ln.Close()
+	go r.RunListener(ln)
+
+	url := "http://" + ln.Addr().String() + "/proto"
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	if body, major := get(t, &http.Client{Transport: transport}, url); major != 2 || body != "HTTP/2.0 http" {
+		t.Fatalf("expect h2c, but got %d %q", major, body)
+	}
+	if body, major := get(t, &http.Client{Transport: &http.Transport{}}, url); major != 1 || body != "HTTP/1.1 http" {
+		t.Fatalf("expect HTTP/1.1, but got %d %q", major, body)
+	}
+}
+
+func TestRunWithoutH2C(t *testing.T) {
+	ln := listen(t)
+	defer ln.Close()
+	go newTestProtoEngine().RunListener(ln)
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	if _, err := (&http.Client{Transport: transport}).Get("http://" + ln.Addr().String() + "/proto"); err == nil {
+		t.Fatal("expect h2c to be rejected unless UseH2C is set")
+	}
+}
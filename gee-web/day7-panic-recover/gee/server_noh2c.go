@@ -0,0 +1,20 @@
+//go:build !go1.24
+// +build !go1.24
+
+package gee
+
+import (
+	"errors"
+	"net/http"
+)
+
+var errH2CUnsupported = errors.New("gee: UseH2C needs Go 1.24")
+
+// setProtocols keeps the defaults of net/http, which serves HTTP/2 over
+// TLS only
+func (engine *Engine) setProtocols(srv *http.Server) error {
+	if engine.UseH2C {
+		return errH2CUnsupported
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !go1.24
+// +build !go1.24
+
+package gee
+
+import "testing"
+
+func TestRunH2CUnsupported(t *testing.T) {
+	r := newTestProtoEngine()
+	r.UseH2C = true
+	ln := listen(t)
+	defer ln.Close()
+	if err := r.RunListener(ln); err != errH2CUnsupported {
+		t.Fatalf("expect %v, but got %v", errH2CUnsupported, err)
+	}
+}
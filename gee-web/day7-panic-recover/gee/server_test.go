@@ -0,0 +1,60 @@
+package gee
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func newTestProtoEngine() *Engine {
+	r := New()
+	r.GET("/proto", func(c *Context) {
+		c.String(http.StatusOK, "%s %s", c.Req.Proto, c.Scheme())
+	})
+	return r
+}
+
+func listen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+func get(t *testing.T, client *http.Client, url string) (string, int) {
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return string(body), res.ProtoMajor
+}
+
+func TestRunTLS(t *testing.T) {
+	cert, err := SelfSignedCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := listen(t)
+	defer ln.Close()
+	go newTestProtoEngine().RunTLSListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	url := "https://" + ln.Addr().String() + "/proto"
+
+	h2 := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}}
+	if body, major := get(t, h2, url); major != 2 || body != "HTTP/2.0 https" {
+		t.Fatalf("expect HTTP/2 over TLS, but got %d %q", major, body)
+	}
+
+	h1 := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	if body, major := get(t, h1, url); major != 1 || body != "HTTP/1.1 https" {
+		t.Fatalf("expect HTTP/1.1 over TLS, but got %d %q", major, body)
+	}
+}
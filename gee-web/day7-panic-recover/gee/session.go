@@ -0,0 +1,448 @@
+package gee
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const flashKey = "_flash"
+
+func init() {
+	// flash messages are stored as a []interface{} session value
+	gob.Register([]interface{}{})
+}
+
+var (
+	errInvalidCookie = errors.New("gee: invalid session cookie")
+	errExpiredCookie = errors.New("gee: expired session cookie")
+)
+
+// SessionOptions configures the session cookie
+type SessionOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int // in seconds, <0 deletes the session, 0 lasts for the browser session
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+func defaultSessionOptions() SessionOptions {
+	return SessionOptions{Path: "/", MaxAge: 86400 * 7, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+}
+
+func (o *SessionOptions) cookie(name string, value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	}
+	if o.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(o.MaxAge) * time.Second)
+	} else if o.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+	return cookie
+}
+
+// Session holds the values of a client across requests.
+// Values must be registered with gob unless they are of basic types.
+type Session struct {
+	ID      string // empty for stores keeping the values in the cookie
+	Values  map[string]interface{}
+	IsNew   bool
+	Options *SessionOptions
+	name    string
+	store   SessionStore
+	ctx     *Context
+	oldID   string // destroyed on Save after RotateID
+}
+
+// NewSession creates an empty session, used by SessionStore implementations
+func NewSession(store SessionStore, name string, options SessionOptions) *Session {
+	return &Session{
+		Values:  make(map[string]interface{}),
+		IsNew:   true,
+		Options: &options,
+		name:    name,
+		store:   store,
+	}
+}
+
+// Name returns the name of the session cookie
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Get returns the session value of key
+func (s *Session) Get(key string) interface{} {
+	return s.Values[key]
+}
+
+// Set sets the session value of key
+func (s *Session) Set(key string, value interface{}) {
+	s.Values[key] = value
+}
+
+// Delete removes the session value of key
+func (s *Session) Delete(key string) {
+	delete(s.Values, key)
+}
+
+// Clear removes all session values
+func (s *Session) Clear() {
+	s.Values = make(map[string]interface{})
+}
+
+// AddFlash adds a flash message, which is removed once read by Flashes
+func (s *Session) AddFlash(value interface{}) {
+	flashes, _ := s.Values[flashKey].([]interface{})
+	s.Values[flashKey] = append(flashes, value)
+}
+
+// Flashes returns and removes the flash messages
+func (s *Session) Flashes() []interface{} {
+	flashes, _ := s.Values[flashKey].([]interface{})
+	delete(s.Values, flashKey)
+	return flashes
+}
+
+// RotateID assigns a new session ID, e.g. after login to prevent session
+// fixation. The old session is destroyed on Save.
+func (s *Session) RotateID() {
+	if s.ID == "" {
+		return
+	}
+	if s.oldID == "" {
+		s.oldID = s.ID
+	}
+	s.ID = newSessionID()
+}
+
+// Save persists the session and sets the session cookie,
+// it must be called before the response is written
+func (s *Session) Save() error {
+	return s.store.Save(s.ctx, s)
+}
+
+// SessionStore loads and saves sessions
+type SessionStore interface {
+	// Load returns the session of the request, or a new session if absent or invalid
+	Load(c *Context, name string) (*Session, error)
+	// Save persists the session and writes its cookie to the response
+	Save(c *Context, s *Session) error
+}
+
+// Sessions provides c.Session() backed by store, using name as the cookie name
+func Sessions(name string, store SessionStore) HandlerFunc {
+	return func(c *Context) {
+		c.sessionName = name
+		c.sessionStore = store
+		c.Next()
+	}
+}
+
+// Session returns the session of the request, loaded on first use. It's
+// a new empty session if the store fails to return one, SessionError
+// returns why.
+func (c *Context) Session() *Session {
+	if c.session != nil {
+		return c.session
+	}
+	if c.sessionStore == nil {
+		panic("gee: Sessions middleware is not used")
+	}
+	s, err := c.sessionStore.Load(c, c.sessionName)
+	c.sessionErr = err
+	if s == nil {
+		s = NewSession(c.sessionStore, c.sessionName, defaultSessionOptions())
+	}
+	s.ctx = c
+	c.session = s
+	return s
+}
+
+// SessionError returns the error of the store loading the session, e.g.
+// an invalid or expired cookie, nil if there was none
+func (c *Context) SessionError() error {
+	return c.sessionErr
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeValues(values map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeValues(data []byte) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// CookieStore keeps session values in the cookie itself, signed with
+// HMAC-SHA256 and optionally encrypted with AES-GCM.
+type CookieStore struct {
+	Options  SessionOptions
+	MaxBytes int // max length of the cookie value, default 4096
+	hashKey  []byte
+	aead     cipher.AEAD
+}
+
+// NewCookieStore creates a CookieStore. hashKey signs the cookie, a
+// blockKey of 16, 24 or 32 bytes enables AES-GCM encryption.
+func NewCookieStore(hashKey []byte, blockKey []byte) (*CookieStore, error) {
+	if len(hashKey) == 0 {
+		return nil, errors.New("gee: hash key is required")
+	}
+	s := &CookieStore{Options: defaultSessionOptions(), hashKey: hashKey, MaxBytes: 4096}
+	if blockKey != nil {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Load implements SessionStore
+func (s *CookieStore) Load(c *Context, name string) (*Session, error) {
+	session := NewSession(s, name, s.Options)
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	values, err := s.decode(name, cookie.Value)
+	if err != nil {
+		return session, err
+	}
+	session.Values = values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save implements SessionStore
+func (s *CookieStore) Save(c *Context, session *Session) error {
+	if session.Options.MaxAge < 0 {
+		http.SetCookie(c.Writer, session.Options.cookie(session.name, ""))
+		return nil
+	}
+	value, err := s.encode(session.name, session.Values)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(c.Writer, session.Options.cookie(session.name, value))
+	return nil
+}
+
+func (s *CookieStore) mac(name string, data string) []byte {
+	h := hmac.New(sha256.New, s.hashKey)
+	h.Write([]byte(name + "|" + data))
+	return h.Sum(nil)
+}
+
+// encode returns base64(timestamp|payload|mac), the payload is encrypted
+// if a block key is given, and the mac covers the cookie name as well.
+func (s *CookieStore) encode(name string, values map[string]interface{}) (string, error) {
+	payload, err := encodeValues(values)
+	if err != nil {
+		return "", err
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		payload = s.aead.Seal(nonce, nonce, payload, []byte(name))
+	}
+	data := strconv.FormatInt(time.Now().Unix(), 10) + "|" + base64.RawURLEncoding.EncodeToString(payload)
+	mac := base64.RawURLEncoding.EncodeToString(s.mac(name, data))
+	value := base64.RawURLEncoding.EncodeToString([]byte(data + "|" + mac))
+	if s.MaxBytes > 0 && len(value) > s.MaxBytes {
+		return "", fmt.Errorf("gee: session cookie is too long: %d bytes", len(value))
+	}
+	return value, nil
+}
+
+func (s *CookieStore) decode(name string, value string) (map[string]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+	parts := strings.SplitN(string(b), "|", 3)
+	if len(parts) != 3 {
+		return nil, errInvalidCookie
+	}
+	data := parts[0] + "|" + parts[1]
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, s.mac(name, data)) {
+		return nil, errInvalidCookie
+	}
+	created, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+	if s.Options.MaxAge > 0 && time.Now().Unix()-created > int64(s.Options.MaxAge) {
+		return nil, errExpiredCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+	if s.aead != nil {
+		n := s.aead.NonceSize()
+		if len(payload) < n {
+			return nil, errInvalidCookie
+		}
+		if payload, err = s.aead.Open(nil, payload[:n], payload[n:], []byte(name)); err != nil {
+			return nil, errInvalidCookie
+		}
+	}
+	return decodeValues(payload)
+}
+
+type serverSession struct {
+	data     []byte
+	expire   time.Time
+	lastUsed time.Time
+}
+
+// MemorySessionStore keeps session values in memory, the cookie only
+// carries the random session ID.
+type MemorySessionStore struct {
+	Options SessionOptions
+	// IdleTimeout removes the sessions not loaded or saved for that long,
+	// even if their cookie lasts for the browser session. Default 24h,
+	// zero keeps them until MaxAge.
+	IdleTimeout time.Duration
+	mu          sync.Mutex
+	sessions    map[string]serverSession
+	lastSweep   time.Time
+}
+
+// NewMemorySessionStore is the constructor of MemorySessionStore
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		Options:     defaultSessionOptions(),
+		IdleTimeout: 24 * time.Hour,
+		sessions:    make(map[string]serverSession),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (s *MemorySessionStore) expired(ss serverSession, now time.Time) bool {
+	if !ss.expire.IsZero() && now.After(ss.expire) {
+		return true
+	}
+	return s.IdleTimeout > 0 && now.Sub(ss.lastUsed) > s.IdleTimeout
+}
+
+// Load implements SessionStore
+func (s *MemorySessionStore) Load(c *Context, name string) (*Session, error) {
+	session := NewSession(s, name, s.Options)
+	session.ID = newSessionID()
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	ss, ok := s.sessions[cookie.Value]
+	if ok && s.expired(ss, now) {
+		delete(s.sessions, cookie.Value)
+		ok = false
+	} else if ok {
+		ss.lastUsed = now
+		s.sessions[cookie.Value] = ss
+	}
+	s.mu.Unlock()
+	if !ok {
+		return session, nil
+	}
+
+	values, err := decodeValues(ss.data)
+	if err != nil {
+		return session, err
+	}
+	session.ID = cookie.Value
+	session.Values = values
+	session.IsNew = false
+	return session, nil
+}
+
+// Save implements SessionStore
+func (s *MemorySessionStore) Save(c *Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+	if session.oldID != "" {
+		delete(s.sessions, session.oldID)
+		session.oldID = ""
+	}
+	if session.Options.MaxAge < 0 {
+		delete(s.sessions, session.ID)
+		http.SetCookie(c.Writer, session.Options.cookie(session.name, ""))
+		return nil
+	}
+
+	data, err := encodeValues(session.Values)
+	if err != nil {
+		return err
+	}
+	ss := serverSession{data: data, lastUsed: time.Now()}
+	if session.Options.MaxAge > 0 {
+		ss.expire = ss.lastUsed.Add(time.Duration(session.Options.MaxAge) * time.Second)
+	}
+	s.sessions[session.ID] = ss
+	http.SetCookie(c.Writer, session.Options.cookie(session.name, session.ID))
+	return nil
+}
+
+// sweep removes expired and idle sessions at most once a minute
+func (s *MemorySessionStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, ss := range s.sessions {
+		if s.expired(ss, now) {
+			delete(s.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSessionEngine(store SessionStore) *Engine {
+	r := New()
+	r.Use(Sessions("gee_session", store))
+	r.GET("/login", func(c *Context) {
+		s := c.Session()
+		s.RotateID()
+		s.Set("user", "geektutu")
+		s.AddFlash("welcome")
+		if err := s.Save(); err != nil {
+			c.Fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/whoami", func(c *Context) {
+		s := c.Session()
+		flashes := s.Flashes()
+		s.Save()
+		c.String(http.StatusOK, "%v %v", s.Get("user"), flashes)
+	})
+	r.GET("/logout", func(c *Context) {
+		s := c.Session()
+		s.Options.MaxAge = -1
+		s.Save()
+		c.String(http.StatusOK, "bye")
+	})
+	return r
+}
+
+func serveWithCookies(r *Engine, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func testSessionStore(t *testing.T, store SessionStore) {
+	r := newTestSessionEngine(store)
+	w := serveWithCookies(r, "/login", nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "gee_session" || !cookies[0].HttpOnly {
+		t.Fatalf("expect session cookie to be set, but got %v", cookies)
+	}
+
+	if w = serveWithCookies(r, "/whoami", cookies); w.Body.String() != "geektutu [welcome]" {
+		t.Fatalf("expect user and flash, but got %q", w.Body.String())
+	}
+	cookies = w.Result().Cookies()
+	if w = serveWithCookies(r, "/whoami", cookies); w.Body.String() != "geektutu []" {
+		t.Fatalf("expect flash to be read once, but got %q", w.Body.String())
+	}
+
+	// tampered cookie starts a new session
+	tampered := &http.Cookie{Name: "gee_session", Value: strings.ToUpper(cookies[0].Value)}
+	if w = serveWithCookies(r, "/whoami", []*http.Cookie{tampered}); w.Body.String() != "<nil> []" {
+		t.Fatalf("expect tampered cookie to be rejected, but got %q", w.Body.String())
+	}
+
+	w = serveWithCookies(r, "/logout", cookies)
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Fatalf("expect session cookie to be deleted, but got %v", c)
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	store, err := NewCookieStore([]byte("hash-key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+
+	store, err = NewCookieStore([]byte("hash-key"), []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSessionStore(t, store)
+
+	if _, err := NewCookieStore([]byte("hash-key"), []byte("short")); err == nil {
+		t.Fatal("expect error for invalid block key")
+	}
+}
+
+func TestCookieStoreKeys(t *testing.T) {
+	store1, _ := NewCookieStore([]byte("key1"), []byte("0123456789abcdef"))
+	store2, _ := NewCookieStore([]byte("key2"), []byte("0123456789abcdef"))
+	value, err := store1.encode("s", map[string]interface{}{"user": "geektutu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store2.decode("s", value); err == nil {
+		t.Fatal("expect cookie signed with another key to be rejected")
+	}
+	if _, err := store1.decode("other", value); err == nil {
+		t.Fatal("expect cookie of another name to be rejected")
+	}
+	if values, err := store1.decode("s", value); err != nil || values["user"] != "geektutu" {
+		t.Fatalf("decode failed: %v %v", values, err)
+	}
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	store := NewMemorySessionStore()
+	testSessionStore(t, store)
+
+	// the session ID is rotated on login, old IDs are destroyed
+	r := newTestSessionEngine(store)
+	old := serveWithCookies(r, "/login", nil).Result().Cookies()
+	rotated := serveWithCookies(r, "/login", old).Result().Cookies()
+	if old[0].Value == rotated[0].Value {
+		t.Fatal("expect session ID to be rotated")
+	}
+	if _, ok := store.sessions[old[0].Value]; ok {
+		t.Fatal("expect old session to be destroyed")
+	}
+
+	// idle sessions are swept even if the cookie lasts for the browser session
+	store.Options.MaxAge = 0
+	store.IdleTimeout = time.Hour
+	idle := serveWithCookies(r, "/login", nil).Result().Cookies()
+	store.mu.Lock()
+	ss := store.sessions[idle[0].Value]
+	ss.lastUsed = ss.lastUsed.Add(-2 * time.Hour)
+	store.sessions[idle[0].Value] = ss
+	store.lastSweep = store.lastSweep.Add(-time.Hour)
+	store.mu.Unlock()
+	serveWithCookies(r, "/whoami", nil)
+	if _, ok := store.sessions[idle[0].Value]; ok {
+		t.Fatal("expect idle session to be swept")
+	}
+}
+
+// brokenStore fails to load any session
+type brokenStore struct{}
+
+func (brokenStore) Load(c *Context, name string) (*Session, error) {
+	return nil, errors.New("store down")
+}
+
+func (brokenStore) Save(c *Context, s *Session) error {
+	return errors.New("store down")
+}
+
+func TestSessionStoreError(t *testing.T) {
+	r := newTestSessionEngine(brokenStore{})
+	if w := serveWithCookies(r, "/whoami", nil); w.Code != http.StatusOK || w.Body.String() != "<nil> []" {
+		t.Fatalf("expect an empty session, but got %d %q", w.Code, w.Body.String())
+	}
+	r.GET("/error", func(c *Context) {
+		c.Session()
+		c.String(http.StatusOK, "%v", c.SessionError())
+	})
+	if w := serveWithCookies(r, "/error", nil); w.Body.String() != "store down" {
+		t.Fatalf("expect the error of the store, but got %q", w.Body.String())
+	}
+}
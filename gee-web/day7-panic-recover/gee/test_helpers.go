@@ -0,0 +1,14 @@
+package gee
+
+import "net/http"
+
+// NewTestContext returns a fresh engine and a context for testing handlers
+// directly, the request of the context is a GET to "/". When c.Req is
+// replaced, update c.Path and c.Method too.
+func NewTestContext(w http.ResponseWriter) (c *Context, r *Engine) {
+	r = New()
+	req, _ := http.NewRequest("GET", "/", nil)
+	c = newContext(w, req)
+	c.engine = r
+	return
+}
@@ -0,0 +1,132 @@
+package gee
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"gee/tracing"
+)
+
+// RequestIDHeader is the header carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID propagates the X-Request-ID of the request, or generates one.
+// The ID is set on both the request and response headers.
+func RequestID() HandlerFunc {
+	return func(c *Context) {
+		id := c.Req.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			c.Req.Header.Set(RequestIDHeader, id)
+		}
+		c.SetHeader(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+var (
+	randRead     = rand.Read
+	requestIDSeq uint64
+)
+
+// newRequestID returns 16 random bytes in hex. If the system can't provide
+// them, the time and a counter keep the IDs unique within the process.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := randRead(b); err != nil {
+		binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:], atomic.AddUint64(&requestIDSeq, 1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts up to 128 printable ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID returns the ID set by the RequestID middleware
+func (c *Context) RequestID() string {
+	return c.Req.Header.Get(RequestIDHeader)
+}
+
+// Tracing records a span for the request and a child span for each
+// handler after it, continuing the trace of the caller given by the
+// traceparent header. The span context is put on c.Req.Context().
+func Tracing(tracer tracing.Tracer) HandlerFunc {
+	return func(c *Context) {
+		ctx := c.Req.Context()
+		if parent, ok := tracing.Extract(c.Req.Header); ok {
+			ctx = tracing.ContextWithSpanContext(ctx, parent)
+		}
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Method+" "+route)
+		defer span.End()
+		span.SetAttribute("http.method", c.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", c.Req.URL.RequestURI())
+		span.SetAttribute("http.client_ip", c.ClientIP())
+		if id := c.RequestID(); id != "" {
+			span.SetAttribute("http.request_id", id)
+		}
+
+		c.Req = c.Req.WithContext(ctx)
+		c.tracer = tracer
+		defer func() {
+			if err := recover(); err != nil {
+				span.SetError(fmt.Errorf("panic: %v", err))
+				panic(err)
+			}
+		}()
+		c.Next()
+
+		status := c.StatusCode
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(fmt.Errorf("%d %s", status, http.StatusText(status)))
+		}
+	}
+}
+
+// traceHandler calls handler in a child span of the request
+func (c *Context) traceHandler(handler HandlerFunc) {
+	parent := c.Req.Context()
+	ctx, span := c.tracer.Start(parent, handlerName(handler))
+	c.Req = c.Req.WithContext(ctx)
+	defer func() {
+		span.End()
+		// the following handlers are siblings, unless the context was replaced
+		if c.Req.Context() == ctx {
+			c.Req = c.Req.WithContext(parent)
+		}
+	}()
+	handler(c)
+}
+
+func handlerName(handler HandlerFunc) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return "handler"
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.IsSampled() {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Fatalf("unexpected traceparent %s", sc.Traceparent())
+	}
+
+	// future versions may append fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(s); err == nil {
+			t.Errorf("expect %q to be invalid", s)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Add(TracestateHeader, "congo=t61rcWkgMzE")
+	h.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+	parent, ok := Extract(h)
+	if !ok || !parent.Remote || parent.TraceState != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Fatalf("unexpected span context %+v", parent)
+	}
+
+	exporter := &InMemoryExporter{}
+	tracer := NewTracer(exporter)
+	ctx, span := tracer.Start(ContextWithSpanContext(context.Background(), parent), "child")
+	span.SetAttribute("k", "v")
+	span.End()
+	span.End()
+
+	out := http.Header{}
+	Inject(ctx, out)
+	child, _ := Extract(out)
+	if child.TraceID != parent.TraceID || child.SpanID == parent.SpanID || child.TraceState != parent.TraceState {
+		t.Fatalf("expect child of %+v, but got %+v", parent, child)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 1 || spans[0].Parent != parent.SpanID || spans[0].Attributes["k"] != "v" {
+		t.Fatalf("expect one exported child span, but got %+v", spans)
+	}
+}
+
+func TestNotSampled(t *testing.T) {
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	exporter := &InMemoryExporter{}
+	_, span := NewTracer(exporter).Start(ContextWithSpanContext(context.Background(), parent), "child")
+	span.End()
+	if len(exporter.Spans()) != 0 {
+		t.Fatal("expect spans of unsampled traces not exported")
+	}
+
+	_, root := NewTracer(exporter).Start(context.Background(), "root")
+	root.End()
+	if spans := exporter.Spans(); len(spans) != 1 || spans[0].Parent.IsValid() {
+		t.Fatalf("expect a root span, but got %+v", spans)
+	}
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Span is an operation being traced
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value interface{})
+	// SetError marks the span as failed
+	SetError(err error)
+	End()
+}
+
+// Tracer starts spans, the span started is a child of the span carried
+// by ctx, and the returned context carries the new span
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// SpanData is a finished span
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanID // zero for root spans
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Err         error
+}
+
+// Exporter receives the finished spans
+type Exporter interface {
+	Export(span *SpanData)
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+// NewTracer returns a Tracer exporting the sampled spans to exporter.
+// Traces started by the tracer are sampled, remote parents decide for
+// the traces they started.
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &span{
+		tracer: t,
+		data: SpanData{
+			Name:  name,
+			Start: time.Now(),
+		},
+	}
+	if parent, ok := SpanContextFromContext(ctx); ok {
+		s.data.SpanContext = SpanContext{TraceID: parent.TraceID, Flags: parent.Flags, TraceState: parent.TraceState}
+		s.data.Parent = parent.SpanID
+	} else {
+		s.data.SpanContext = SpanContext{TraceID: newTraceID(), Flags: FlagsSampled}
+	}
+	s.data.SpanContext.SpanID = newSpanID()
+	return ContextWithSpanContext(ctx, s.data.SpanContext), s
+}
+
+type span struct {
+	tracer *tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *span) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	if data.SpanContext.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(&data)
+	}
+}
+
+// InMemoryExporter keeps the finished spans in memory, useful for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+// Export implements Exporter
+func (e *InMemoryExporter) Export(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the finished spans in the order they ended
+func (e *InMemoryExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// Reset removes all spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,79 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gee/tracing"
+)
+
+func TestRequestID(t *testing.T) {
+	r := New()
+	r.Use(RequestID())
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, "%s", c.RequestID())
+	})
+
+	w := serve(r, "GET", "/", http.Header{"X-Request-Id": {"abc-123"}})
+	if w.Header().Get(RequestIDHeader) != "abc-123" || w.Body.String() != "abc-123" {
+		t.Fatalf("expect request ID to be propagated, but got %q", w.Header().Get(RequestIDHeader))
+	}
+	w = serve(r, "GET", "/", http.Header{"X-Request-Id": {"bad id\n"}})
+	if id := w.Header().Get(RequestIDHeader); len(id) != 32 || id != w.Body.String() {
+		t.Fatalf("expect request ID to be generated, but got %q", id)
+	}
+}
+
+func TestRequestIDWithoutRandomness(t *testing.T) {
+	defer func(read func([]byte) (int, error)) { randRead = read }(randRead)
+	randRead = func(b []byte) (int, error) { return 0, errors.New("no entropy") }
+
+	a, b := newRequestID(), newRequestID()
+	if len(a) != 32 || len(b) != 32 || a == b {
+		t.Fatalf("expect distinct IDs, but got %q and %q", a, b)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &tracing.InMemoryExporter{}
+	var traceparent string
+	r := New()
+	r.Use(Tracing(tracing.NewTracer(exporter)), func(c *Context) {
+		c.Next()
+	})
+	r.GET("/hello/:name", func(c *Context) {
+		// forward the trace context, e.g. to an RPC client
+		h := http.Header{}
+		tracing.Inject(c.Req.Context(), h)
+		traceparent = h.Get(tracing.TraceparentHeader)
+		c.String(http.StatusOK, "hello")
+	})
+
+	serve(r, "GET", "/hello/geektutu", http.Header{
+		"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("expect spans of the request, middleware and handler, but got %d", len(spans))
+	}
+	handler, middleware, request := spans[0], spans[1], spans[2]
+	if request.Name != "GET /hello/:name" || request.Parent.String() != "00f067aa0ba902b7" ||
+		request.SpanContext.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected request span %+v", request)
+	}
+	if request.Attributes["http.status_code"] != http.StatusOK {
+		t.Fatalf("expect status code 200, but got %v", request.Attributes["http.status_code"])
+	}
+	if middleware.Parent != request.SpanContext.SpanID || handler.Parent != middleware.SpanContext.SpanID {
+		t.Fatal("expect handler spans to be nested")
+	}
+	if !strings.HasPrefix(handler.Name, "gee.TestTracing") {
+		t.Fatalf("expect span named by the handler, but got %s", handler.Name)
+	}
+	if !strings.Contains(traceparent, handler.SpanContext.SpanID.String()) {
+		t.Fatalf("expect trace context on the request context, but got %q", traceparent)
+	}
+}
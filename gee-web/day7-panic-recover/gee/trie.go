@@ -16,8 +16,14 @@ func (n *node) String() string {
 	return fmt.Sprintf("node{pattern=%s, part=%s, isWild=%t}", n.pattern, n.part, n.isWild)
 }
 
-func (n *node) insert(pattern string, parts []string, height int) {
+// insert adds the node of pattern. If slash is true, which trailing slash
+// redirects need, it panics when another pattern with a different trailing
+// slash has the same node, e.g. /foo and /foo/, or /:id and /about/
+func (n *node) insert(pattern string, parts []string, height int, slash bool) {
 	if len(parts) == height {
+		if slash && n.pattern != "" && strings.HasSuffix(n.pattern, "/") != strings.HasSuffix(pattern, "/") {
+			panic(fmt.Sprintf("gee: route %s conflicts with %s", pattern, n.pattern))
+		}
 		n.pattern = pattern
 		return
 	}
@@ -28,10 +34,12 @@ func (n *node) insert(pattern string, parts []string, height int) {
 		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
 		n.children = append(n.children, child)
 	}
-	child.insert(pattern, parts, height+1)
+	child.insert(pattern, parts, height+1, slash)
 }
 
-func (n *node) search(parts []string, height int) *node {
+// search finds the node of parts, static parts are compared
+// case-insensitively when fold is true
+func (n *node) search(parts []string, height int, fold bool) *node {
 	if len(parts) == height || strings.HasPrefix(n.part, "*") {
 		if n.pattern == "" {
 			return nil
@@ -40,10 +48,10 @@ func (n *node) search(parts []string, height int) *node {
 	}
 
 	part := parts[height]
-	children := n.matchChildren(part)
+	children := n.matchChildren(part, fold)
 
 	for _, child := range children {
-		result := child.search(parts, height+1)
+		result := child.search(parts, height+1, fold)
 		if result != nil {
 			return result
 		}
@@ -70,10 +78,10 @@ func (n *node) matchChild(part string) *node {
 	return nil
 }
 
-func (n *node) matchChildren(part string) []*node {
+func (n *node) matchChildren(part string, fold bool) []*node {
 	nodes := make([]*node, 0)
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
+		if child.part == part || child.isWild || (fold && strings.EqualFold(child.part, part)) {
 			nodes = append(nodes, child)
 		}
 	}
@@ -4,4 +4,9 @@ go 1.13
 
 require gee v0.0.0
 
-replace gee => ./gee
+require gee/metrics v0.0.0 // indirect
+
+replace (
+	gee => ./gee
+	gee/metrics => ./gee/metrics
+)
@@ -46,7 +46,7 @@ func main() {
 	// index out of range for testing Recovery()
 	r.GET("/panic", func(c *gee.Context) {
 		names := []string{"geektutu"}
-		c.String(http.StatusOK, names[100])
+		c.String(http.StatusOK, "%s", names[100])
 	})
 
 	r.Run(":9999")